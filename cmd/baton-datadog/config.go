@@ -4,16 +4,28 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/conductorone/baton-datadog/pkg/connector"
 	"github.com/conductorone/baton-sdk/pkg/cli"
 	"github.com/spf13/cobra"
 )
 
 // config defines the external configuration required for the connector to run.
 type config struct {
-	cli.BaseConfig `mapstructure:",squash"` // Puts the base config options in the same place as the connector options
-	Site           string                   `mapstructure:"site"`
-	ApiKey         string                   `mapstructure:"api-key"`
-	AppKey         string                   `mapstructure:"app-key"`
+	cli.BaseConfig     `mapstructure:",squash"` // Puts the base config options in the same place as the connector options
+	Site               string                   `mapstructure:"site"`
+	BaseURL            string                   `mapstructure:"base-url"`
+	ApiKey             string                   `mapstructure:"api-key"`
+	AppKey             string                   `mapstructure:"app-key"`
+	ApiKeyFile         string                   `mapstructure:"api-key-file"`
+	AppKeyFile         string                   `mapstructure:"app-key-file"`
+	ReadOnly           bool                     `mapstructure:"read-only"`
+	DryRun             bool                     `mapstructure:"dry-run"`
+	GrantConcurrency   int                      `mapstructure:"grant-concurrency"`
+	PagerDutyServices  []string                 `mapstructure:"pagerduty-services"`
+	SlackAccounts      []string                 `mapstructure:"slack-accounts"`
+	Webhooks           []string                 `mapstructure:"webhooks"`
+	IPAllowlistEntries []string                 `mapstructure:"ip-allowlist-entries"`
+	Provisioning       bool                     `mapstructure:"provisioning"` // Set by the SDK's --provisioning flag
 }
 
 // validateConfig is run after the configuration is loaded, and should return an error if it isn't valid.
@@ -22,12 +34,31 @@ func validateConfig(ctx context.Context, cfg *config) error {
 		return fmt.Errorf("site is required, please provide it via --site flag or BATON_SITE environment variable")
 	}
 
-	if cfg.ApiKey == "" {
-		return fmt.Errorf("API key is required, please provide it via --api-key flag or BATON_API_KEY environment variable")
+	if cfg.BaseURL == "" {
+		err := connector.ValidateSite(cfg.Site)
+		if err != nil {
+			return err
+		}
 	}
 
-	if cfg.AppKey == "" {
-		return fmt.Errorf("app key is required, please provide it via --app-key flag or BATON_APP_KEY environment variable")
+	if cfg.ApiKey == "" && cfg.ApiKeyFile == "" {
+		return fmt.Errorf("API key is required, please provide it via --api-key or --api-key-file flag or BATON_API_KEY or BATON_API_KEY_FILE environment variable")
+	}
+
+	if cfg.ApiKey != "" && cfg.ApiKeyFile != "" {
+		return fmt.Errorf("--api-key and --api-key-file cannot be used together")
+	}
+
+	if cfg.AppKey == "" && cfg.AppKeyFile == "" {
+		return fmt.Errorf("app key is required, please provide it via --app-key or --app-key-file flag or BATON_APP_KEY or BATON_APP_KEY_FILE environment variable")
+	}
+
+	if cfg.AppKey != "" && cfg.AppKeyFile != "" {
+		return fmt.Errorf("--app-key and --app-key-file cannot be used together")
+	}
+
+	if cfg.GrantConcurrency < 0 {
+		return fmt.Errorf("--grant-concurrency cannot be negative")
 	}
 
 	return nil
@@ -36,6 +67,16 @@ func validateConfig(ctx context.Context, cfg *config) error {
 // cmdFlags sets the cmdFlags required for the connector.
 func cmdFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().String("site", "", "Part of your Datadog website URL, e.g. datadoghq.com in https://app.datadoghq.com. ($BATON_SITE)")
+	cmd.PersistentFlags().String("base-url", "", "Override the Datadog API URL derived from the site, e.g. to go through a proxy. ($BATON_BASE_URL)")
 	cmd.PersistentFlags().String("api-key", "", "API key used to authenticate to Datadog API. ($BATON_API_KEY)")
 	cmd.PersistentFlags().String("app-key", "", "APP key used with API key to assign scopes for API access. ($BATON_APP_KEY)")
+	cmd.PersistentFlags().String("api-key-file", "", "Path to a file containing the API key, re-read when it changes so the key can be rotated. ($BATON_API_KEY_FILE)")
+	cmd.PersistentFlags().String("app-key-file", "", "Path to a file containing the APP key, re-read when it changes so the key can be rotated. ($BATON_APP_KEY_FILE)")
+	cmd.PersistentFlags().Bool("read-only", false, "Reject every provisioning action, even when --provisioning is set. ($BATON_READ_ONLY)")
+	cmd.PersistentFlags().Bool("dry-run", false, "Report the changes provisioning actions would make in Datadog without making them. ($BATON_DRY_RUN)")
+	cmd.PersistentFlags().Int("grant-concurrency", 0, "Number of teams and roles whose memberships are fetched concurrently during a sync, 0 fetches them one at a time. ($BATON_GRANT_CONCURRENCY)")
+	cmd.PersistentFlags().StringSlice("pagerduty-services", nil, "Names of the PagerDuty integration services to sync, Datadog cannot list them. ($BATON_PAGERDUTY_SERVICES)")
+	cmd.PersistentFlags().StringSlice("slack-accounts", nil, "Names of the Slack integration accounts to sync along with their channels, Datadog cannot list them. ($BATON_SLACK_ACCOUNTS)")
+	cmd.PersistentFlags().StringSlice("webhooks", nil, "Names of the Webhooks integration webhooks to sync, Datadog cannot list them. ($BATON_WEBHOOKS)")
+	cmd.PersistentFlags().StringSlice("ip-allowlist-entries", nil, "CIDR blocks or IP addresses, optionally followed by =note, synced as IP allowlist entries so they can be added to the allowlist. ($BATON_IP_ALLOWLIST_ENTRIES)")
 }
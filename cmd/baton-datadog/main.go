@@ -39,7 +39,22 @@ func main() {
 func getConnector(ctx context.Context, cfg *config) (types.ConnectorServer, error) {
 	l := ctxzap.Extract(ctx)
 
-	cb, err := connector.New(ctx, cfg.Site, cfg.ApiKey, cfg.AppKey)
+	cb, err := connector.New(ctx, connector.Config{
+		Site:               cfg.Site,
+		BaseURL:            cfg.BaseURL,
+		APIKey:             cfg.ApiKey,
+		AppKey:             cfg.AppKey,
+		APIKeyFile:         cfg.ApiKeyFile,
+		AppKeyFile:         cfg.AppKeyFile,
+		Provisioning:       cfg.Provisioning,
+		ReadOnly:           cfg.ReadOnly,
+		DryRun:             cfg.DryRun,
+		GrantConcurrency:   cfg.GrantConcurrency,
+		PagerDutyServices:  cfg.PagerDutyServices,
+		SlackAccounts:      cfg.SlackAccounts,
+		Webhooks:           cfg.Webhooks,
+		IPAllowlistEntries: cfg.IPAllowlistEntries,
+	})
 	if err != nil {
 		l.Error("error creating connector", zap.Error(err))
 		return nil, err
@@ -0,0 +1,133 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+)
+
+// provisioningScopes are the scopes the application key needs to change role and team memberships.
+var provisioningScopes = []string{"user_access_manage", "teams_manage"}
+
+// optionalProvisioningScope is a scope only the provisioning of some resources needs. Without it the connector
+// still starts, and provisioning those resources fails with the permission error Datadog returns.
+type optionalProvisioningScope struct {
+	scope     string
+	resources string
+}
+
+var optionalProvisioningScopes = []optionalProvisioningScope{
+	{scope: "logs_write_archives", resources: "logs archive readers"},
+	{scope: "org_management", resources: "IP allowlist entries"},
+}
+
+// appKeyScopes describes the authorization scopes of the application key used by the connector.
+type appKeyScopes struct {
+	// Restricted is false when the key carries no scopes, in which case it has every permission of its owner.
+	Restricted bool
+	Scopes     []string
+	// OwnerID is the ID of the user owning the key.
+	OwnerID string
+}
+
+// Has reports whether the application key is granted the scope.
+func (s *appKeyScopes) Has(scope string) bool {
+	if !s.Restricted {
+		return true
+	}
+
+	for _, v := range s.Scopes {
+		if v == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Missing returns the scopes the application key is not granted.
+func (s *appKeyScopes) Missing(scopes []string) []string {
+	var rv []string
+	for _, scope := range scopes {
+		if !s.Has(scope) {
+			rv = append(rv, scope)
+		}
+	}
+
+	return rv
+}
+
+// WriteScopes returns the scopes of the application key allowing changes in Datadog.
+func (s *appKeyScopes) WriteScopes() []string {
+	var rv []string
+	for _, scope := range s.Scopes {
+		if strings.HasSuffix(scope, "_write") || strings.HasSuffix(scope, "_manage") {
+			rv = append(rv, scope)
+		}
+	}
+
+	return rv
+}
+
+// getAppKeyScopes looks up the scopes of the application key among the keys of its owner.
+// Datadog only exposes the last four characters of existing keys, which is what the key is matched on.
+func getAppKeyScopes(ctx context.Context, client *client) (*appKeyScopes, error) {
+	_, appKey := client.credentials.Keys(ctx)
+	if len(appKey) < 4 {
+		return nil, fmt.Errorf("baton-datadog: application key is too short")
+	}
+	last4 := appKey[len(appKey)-4:]
+
+	api := datadogV2.NewKeyManagementApi(client.api)
+	for page := int64(0); ; page++ {
+		keys, resp, err := api.ListCurrentUserApplicationKeys(ctx, *datadogV2.NewListCurrentUserApplicationKeysOptionalParameters().WithPageNumber(page))
+		if err != nil {
+			return nil, wrapError(err, resp, "baton-datadog: failed to list application keys")
+		}
+
+		if len(keys.GetData()) == 0 {
+			break
+		}
+
+		for _, key := range keys.GetData() {
+			if key.Attributes.GetLast4() != last4 {
+				continue
+			}
+
+			rv := &appKeyScopes{}
+			if key.Relationships != nil && key.Relationships.OwnedBy != nil {
+				rv.OwnerID = key.Relationships.OwnedBy.Data.GetId()
+			}
+
+			scopes, ok := key.Attributes.GetScopesOk()
+			if ok && scopes != nil {
+				rv.Restricted = true
+				rv.Scopes = *scopes
+			}
+
+			return rv, nil
+		}
+	}
+
+	return nil, fmt.Errorf("baton-datadog: application key not found among the keys of its owner")
+}
+
+// getUserPermissions returns the names of the permissions the user holds through their roles.
+func getUserPermissions(ctx context.Context, client *client, userID string) ([]string, error) {
+	api := datadogV2.NewUsersApi(client.api)
+	permissions, resp, err := api.ListUserPermissions(ctx, userID)
+	if err != nil {
+		return nil, wrapError(err, resp, fmt.Sprintf("baton-datadog: failed to list permissions of user %s", userID))
+	}
+
+	var rv []string
+	for _, permission := range permissions.GetData() {
+		if permission.Attributes != nil {
+			rv = append(rv, permission.Attributes.GetName())
+		}
+	}
+
+	return rv, nil
+}
@@ -0,0 +1,212 @@
+package connector
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxRetries is how many times a request rejected with a 429 or a server error is retried.
+	maxRetries = 3
+	// defaultRequestsPerSecond paces requests across all builders to stay clear of the Datadog rate limits.
+	defaultRequestsPerSecond = 20
+
+	requestIDHeader = "X-Request-Id"
+)
+
+// client is the Datadog API client shared by every builder. It owns the credentials and site, retries rate limited
+// and failed requests, paces requests through a shared rate limiter and logs every request with a request ID.
+// Builders authenticate a context with WithAuth and pass api to the datadogV1 and datadogV2 API constructors.
+type client struct {
+	api         *datadog.APIClient
+	site        string
+	credentials *credentials
+	limiter     *rateLimiter
+}
+
+func newClient(ctx context.Context, site, baseURL string, credentials *credentials) (*client, error) {
+	httpClient, err := uhttp.NewClient(ctx, uhttp.WithLogger(true, ctxzap.Extract(ctx)))
+	if err != nil {
+		return nil, err
+	}
+
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	limiter := newRateLimiter(defaultRequestsPerSecond)
+	httpClient.Transport = &rotatingTransport{
+		base:        &requestTransport{base: base, limiter: limiter},
+		credentials: credentials,
+	}
+
+	conf := datadog.NewConfiguration()
+	conf.HTTPClient = httpClient
+	conf.RetryConfiguration.EnableRetry = true
+	conf.RetryConfiguration.MaxRetries = maxRetries
+	// Listing incident teams and services is still flagged as unstable by the client.
+	conf.SetUnstableOperationEnabled("v2.ListIncidentTeams", true)
+	conf.SetUnstableOperationEnabled("v2.ListIncidentServices", true)
+	err = configureServer(conf, site, baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{
+		api:         datadog.NewAPIClient(conf),
+		site:        site,
+		credentials: credentials,
+		limiter:     limiter,
+	}, nil
+}
+
+// WithAuth returns a context carrying the current API and application keys and the site of the client.
+func (c *client) WithAuth(ctx context.Context) context.Context {
+	apiKey, appKey := c.credentials.Keys(ctx)
+
+	ctx = context.WithValue(
+		ctx,
+		datadog.ContextAPIKeys,
+		map[string]datadog.APIKey{
+			"apiKeyAuth": {
+				Key: apiKey,
+			},
+			"appKeyAuth": {
+				Key: appKey,
+			},
+		},
+	)
+
+	ctx = context.WithValue(ctx,
+		datadog.ContextServerVariables,
+		map[string]string{
+			"site": c.site,
+		})
+
+	return ctx
+}
+
+// AppURL returns the URL of the Datadog web application for the site of the client.
+func (c *client) AppURL() string {
+	return appURL(c.site)
+}
+
+// requestTransport waits for the rate limiter before every request, tags it with a request ID
+// and logs its outcome, so a failing call can be matched with the connector logs.
+type requestTransport struct {
+	base    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (t *requestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	l := ctxzap.Extract(ctx)
+
+	err := t.limiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	requestID := req.Header.Get(requestIDHeader)
+	if requestID == "" {
+		requestID = newRequestID()
+		req = req.Clone(ctx)
+		req.Header.Set(requestIDHeader, requestID)
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	fields := []zap.Field{
+		zap.String("request_id", requestID),
+		zap.String("method", req.Method),
+		zap.String("path", req.URL.Path),
+		zap.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		l.Debug("baton-datadog: request failed", append(fields, zap.Error(err))...)
+		return nil, err
+	}
+
+	t.limiter.Observe(resp)
+	l.Debug("baton-datadog: request completed", append(fields, zap.Int("status", resp.StatusCode))...)
+
+	return resp, nil
+}
+
+// newRequestID returns a random ID identifying a single request.
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// rateLimiter spaces requests evenly at a fixed rate, and holds all requests back until the rate limit
+// window resets once Datadog reports that no requests remain.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(requestsPerSecond int) *rateLimiter {
+	return &rateLimiter{interval: time.Second / time.Duration(requestsPerSecond)}
+}
+
+// Wait blocks until the next request may be made or the context is done.
+func (r *rateLimiter) Wait(ctx context.Context) error {
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	wait := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	r.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Observe reads the rate limit headers of a response and delays further requests until the window resets
+// when the limit is exhausted.
+func (r *rateLimiter) Observe(resp *http.Response) {
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return
+	}
+
+	reset, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Reset"))
+	if err != nil || reset <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	resumeAt := time.Now().Add(time.Duration(reset) * time.Second)
+	if r.next.Before(resumeAt) {
+		r.next = resumeAt
+	}
+}
@@ -0,0 +1,283 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	cloudAccountManager = "manager"
+
+	awsConfigurationsManage   = "aws_configurations_manage"
+	gcpConfigurationsManage   = "gcp_configurations_manage"
+	azureConfigurationsManage = "azure_configurations_manage"
+)
+
+// cloudAccountLister lists the accounts of a cloud integration as resources, along with the response of the
+// listing call so that missing permissions can be told apart from other errors.
+type cloudAccountLister func(ctx context.Context, client *client) ([]*v2.Resource, *http.Response, error)
+
+// cloudAccountBuilder syncs the accounts of one of the cloud integrations. The accounts are trust relationships
+// Datadog uses to read from the cloud provider, control over them is given by a single Datadog permission
+// rather than per account, so the manager entitlement is granted to every role holding that permission.
+// Credentials of the accounts are never synced.
+type cloudAccountBuilder struct {
+	resourceType    *v2.ResourceType
+	client          *client
+	rolePermissions *rolePermissions
+	provider        string
+	permission      string
+	listAccounts    cloudAccountLister
+}
+
+func (c *cloudAccountBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return c.resourceType
+}
+
+// List returns all the accounts of the cloud integration. Integrations are not paginated.
+func (c *cloudAccountBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ctx = c.client.WithAuth(ctx)
+
+	rv, resp, err := c.listAccounts(ctx, c.client)
+	if err != nil {
+		if hasStatus(resp, http.StatusForbidden) {
+			l.Warn("baton-datadog: not allowed to list cloud integration accounts, skipping them", zap.String("provider", c.provider), zap.Error(err))
+			return nil, "", nil, nil
+		}
+		return nil, "", nil, wrapError(err, resp, fmt.Sprintf("error listing %s integration accounts", c.provider))
+	}
+
+	return rv, "", nil, nil
+}
+
+func (c *cloudAccountBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	managerOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(roleResourceType),
+		ent.WithDisplayName(fmt.Sprintf("%s %s account %s", resource.DisplayName, c.provider, cloudAccountManager)),
+		ent.WithDescription(fmt.Sprintf("Can change or remove %s Datadog %s integration account, given by the %s permission", resource.DisplayName, c.provider, c.permission)),
+	}
+
+	return []*v2.Entitlement{
+		ent.NewPermissionEntitlement(resource, cloudAccountManager, managerOptions...),
+	}, "", nil, nil
+}
+
+// Grants returns the roles holding the permission to manage the integration, expandable to the members of each role.
+func (c *cloudAccountBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	ctx = c.client.WithAuth(ctx)
+
+	rv, err := permissionRoleGrants(ctx, c.client, c.rolePermissions, resource, cloudAccountManager, c.permission)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return rv, "", nil, nil
+}
+
+// Create a new connector resource for an account of the Datadog AWS integration. Accounts are identified by
+// their account ID, or by their access key ID for accounts set up with access keys.
+func awsAccountResource(account *datadogV1.AWSAccount) (*v2.Resource, error) {
+	accountID := account.GetAccountId()
+	if accountID == "" {
+		accountID = account.GetAccessKeyId()
+	}
+
+	// Datadog only returns the namespaces whose collection is overridden for the account, the others follow
+	// the defaults of the integration, so these are reported as overrides rather than as the enabled namespaces.
+	var enabledNamespaces, disabledNamespaces []string
+	for namespace, enabled := range account.GetAccountSpecificNamespaceRules() {
+		if enabled {
+			enabledNamespaces = append(enabledNamespaces, namespace)
+		} else {
+			disabledNamespaces = append(disabledNamespaces, namespace)
+		}
+	}
+	sort.Strings(enabledNamespaces)
+	sort.Strings(disabledNamespaces)
+
+	profile := map[string]interface{}{
+		"account_id":                   account.GetAccountId(),
+		"role_name":                    account.GetRoleName(),
+		"access_key_id":                account.GetAccessKeyId(),
+		"namespace_overrides_enabled":  stringsToInterfaces(enabledNamespaces),
+		"namespace_overrides_disabled": stringsToInterfaces(disabledNamespaces),
+		"excluded_regions":             stringsToInterfaces(account.GetExcludedRegions()),
+		"metrics_collection_enabled":   account.GetMetricsCollectionEnabled(),
+		"resource_collection_enabled":  account.GetResourceCollectionEnabled(),
+		"cspm_enabled":                 account.GetCspmResourceCollectionEnabled(),
+	}
+
+	ret, err := rs.NewAppResource(
+		accountID,
+		awsAccountResourceType,
+		accountID,
+		[]rs.AppTraitOption{rs.WithAppProfile(profile)},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func listAWSAccounts(ctx context.Context, client *client) ([]*v2.Resource, *http.Response, error) {
+	api := datadogV1.NewAWSIntegrationApi(client.api)
+
+	accounts, resp, err := api.ListAWSAccounts(ctx)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	var rv []*v2.Resource
+	for _, account := range accounts.GetAccounts() {
+		accountCopy := account
+		ar, err := awsAccountResource(&accountCopy)
+		if err != nil {
+			return nil, resp, fmt.Errorf("error creating AWS account resource: %w", err)
+		}
+		rv = append(rv, ar)
+	}
+
+	return rv, resp, nil
+}
+
+// Create a new connector resource for a service account of the Datadog GCP integration.
+// A project can be monitored through several service accounts, so accounts are identified by their client email.
+func gcpAccountResource(account *datadogV1.GCPAccount) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"project_id":   account.GetProjectId(),
+		"client_email": account.GetClientEmail(),
+		"client_id":    account.GetClientId(),
+		"host_filters": account.GetHostFilters(),
+		"automute":     account.GetAutomute(),
+		"cspm_enabled": account.GetIsCspmEnabled(),
+	}
+
+	ret, err := rs.NewAppResource(
+		account.GetProjectId(),
+		gcpAccountResourceType,
+		account.GetClientEmail(),
+		[]rs.AppTraitOption{rs.WithAppProfile(profile)},
+		rs.WithDescription(fmt.Sprintf("GCP project %s monitored as %s", account.GetProjectId(), account.GetClientEmail())),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func listGCPAccounts(ctx context.Context, client *client) ([]*v2.Resource, *http.Response, error) {
+	api := datadogV1.NewGCPIntegrationApi(client.api)
+
+	accounts, resp, err := api.ListGCPIntegration(ctx)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	var rv []*v2.Resource
+	for _, account := range accounts {
+		accountCopy := account
+		ar, err := gcpAccountResource(&accountCopy)
+		if err != nil {
+			return nil, resp, fmt.Errorf("error creating GCP account resource: %w", err)
+		}
+		rv = append(rv, ar)
+	}
+
+	return rv, resp, nil
+}
+
+// Create a new connector resource for an app registration of the Datadog Azure integration.
+// Accounts are identified by their tenant and client ID, Datadog requires both to address an account.
+func azureAccountResource(account *datadogV1.AzureAccount) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"tenant_name":              account.GetTenantName(),
+		"client_id":                account.GetClientId(),
+		"host_filters":             account.GetHostFilters(),
+		"app_service_plan_filters": account.GetAppServicePlanFilters(),
+		"container_app_filters":    account.GetContainerAppFilters(),
+		"automute":                 account.GetAutomute(),
+		"custom_metrics_enabled":   account.GetCustomMetricsEnabled(),
+		"cspm_enabled":             account.GetCspmEnabled(),
+	}
+
+	ret, err := rs.NewAppResource(
+		account.GetTenantName(),
+		azureAccountResourceType,
+		fmt.Sprintf("%s/%s", account.GetTenantName(), account.GetClientId()),
+		[]rs.AppTraitOption{rs.WithAppProfile(profile)},
+		rs.WithDescription(fmt.Sprintf("Azure tenant %s monitored as client %s", account.GetTenantName(), account.GetClientId())),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func listAzureAccounts(ctx context.Context, client *client) ([]*v2.Resource, *http.Response, error) {
+	api := datadogV1.NewAzureIntegrationApi(client.api)
+
+	accounts, resp, err := api.ListAzureIntegration(ctx)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	var rv []*v2.Resource
+	for _, account := range accounts {
+		accountCopy := account
+		ar, err := azureAccountResource(&accountCopy)
+		if err != nil {
+			return nil, resp, fmt.Errorf("error creating Azure account resource: %w", err)
+		}
+		rv = append(rv, ar)
+	}
+
+	return rv, resp, nil
+}
+
+func newAWSAccountBuilder(client *client, rolePermissions *rolePermissions) *cloudAccountBuilder {
+	return &cloudAccountBuilder{
+		resourceType:    awsAccountResourceType,
+		client:          client,
+		rolePermissions: rolePermissions,
+		provider:        "AWS",
+		permission:      awsConfigurationsManage,
+		listAccounts:    listAWSAccounts,
+	}
+}
+
+func newGCPAccountBuilder(client *client, rolePermissions *rolePermissions) *cloudAccountBuilder {
+	return &cloudAccountBuilder{
+		resourceType:    gcpAccountResourceType,
+		client:          client,
+		rolePermissions: rolePermissions,
+		provider:        "GCP",
+		permission:      gcpConfigurationsManage,
+		listAccounts:    listGCPAccounts,
+	}
+}
+
+func newAzureAccountBuilder(client *client, rolePermissions *rolePermissions) *cloudAccountBuilder {
+	return &cloudAccountBuilder{
+		resourceType:    azureAccountResourceType,
+		client:          client,
+		rolePermissions: rolePermissions,
+		provider:        "Azure",
+		permission:      azureConfigurationsManage,
+		listAccounts:    listAzureAccounts,
+	}
+}
@@ -3,29 +3,60 @@ package connector
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strings"
 
-	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
-	"github.com/conductorone/baton-sdk/pkg/uhttp"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type Datadog struct {
-	client *datadog.APIClient
-	site   string
-	apiKey string
-	appKey string
+	client          *client
+	rolePermissions *rolePermissions
+	teamMappings    *teamMappings
+	userIndex       *userIndex
+	teamIndex       *teamIndex
+	scannerConfig   *scannerConfiguration
+	prefetcher      *prefetcher
+	// integrationSources are the third-party integrations whose accounts are synced.
+	integrationSources []integrationAccountSource
+	// ipAllowlistEntries are the configured IP allowlist entries, synced even when they are not in the allowlist.
+	ipAllowlistEntries []datadogV2.IPAllowlistEntry
+	provisioning       bool
+	readOnly           bool
+	dryRun             bool
 }
 
 // ResourceSyncers returns a ResourceSyncer for each resource type that should be synced from the upstream service.
 func (d *Datadog) ResourceSyncers(ctx context.Context) []connectorbuilder.ResourceSyncer {
 	return []connectorbuilder.ResourceSyncer{
-		newUserBuilder(d.client, d.site, d.apiKey, d.appKey),
-		newTeamBuilder(d.client, d.site, d.apiKey, d.appKey),
-		newRoleBuilder(d.client, d.site, d.apiKey, d.appKey),
+		newUserBuilder(d.client),
+		newTeamBuilder(d.client, d.rolePermissions, d.teamMappings, d.prefetcher, d.readOnly, d.dryRun),
+		newRoleBuilder(d.client, d.prefetcher, d.readOnly, d.dryRun),
+		newLogsArchiveBuilder(d.client, d.readOnly, d.dryRun),
+		newSyntheticsGlobalVariableBuilder(d.client, d.rolePermissions),
+		newSyntheticsPrivateLocationBuilder(d.client, d.rolePermissions),
+		newSyntheticsTestBuilder(d.client, d.rolePermissions, d.userIndex),
+		newServiceBuilder(d.client, d.teamIndex),
+		newAWSAccountBuilder(d.client, d.rolePermissions),
+		newGCPAccountBuilder(d.client, d.rolePermissions),
+		newAzureAccountBuilder(d.client, d.rolePermissions),
+		newIntegrationAccountBuilder(d.client, d.integrationSources),
+		newSecurityMonitoringRuleBuilder(d.client, d.rolePermissions, d.userIndex),
+		newSecurityFilterBuilder(d.client, d.rolePermissions),
+		newScannerGroupBuilder(d.client, d.rolePermissions, d.scannerConfig),
+		newScannerRuleBuilder(d.client, d.rolePermissions, d.scannerConfig),
+		newIPAllowlistBuilder(d.client, d.readOnly, d.dryRun),
+		newIPAllowlistEntryBuilder(d.client, d.ipAllowlistEntries),
+		newIncidentTeamBuilder(d.client, d.teamIndex),
+		newIncidentServiceBuilder(d.client, d.teamIndex),
 	}
 }
 
@@ -33,41 +64,270 @@ func (d *Datadog) ResourceSyncers(ctx context.Context) []connectorbuilder.Resour
 func (d *Datadog) Metadata(ctx context.Context) (*v2.ConnectorMetadata, error) {
 	return &v2.ConnectorMetadata{
 		DisplayName: "Baton Datadog Connector",
-		Description: "Connector syncing users, teams, and roles from Datadog.",
+		Description: "Connector syncing users, teams, roles, logs archives, Synthetics, Service Catalog services, integration accounts, Security Monitoring, Sensitive Data Scanner, the IP allowlist and incident teams and services from Datadog.",
 	}, nil
 }
 
 // Validate is called to ensure that the connector is properly configured. It should exercise any API credentials
 // to be sure that they are valid.
 func (d *Datadog) Validate(ctx context.Context) (annotations.Annotations, error) {
-	ctx = withAuthContext(ctx, d.apiKey, d.appKey, d.site)
-	api := datadogV1.NewAuthenticationApi(d.client)
-	resp, _, err := api.Validate(ctx)
+	ctx = d.client.WithAuth(ctx)
+	api := datadogV1.NewAuthenticationApi(d.client.api)
+	validation, resp, err := api.Validate(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("datadog-connector: failed to validate API key: %w", err)
+		return nil, wrapError(err, resp, "datadog-connector: failed to validate API key")
 	}
 
-	if !resp.GetValid() {
-		return nil, fmt.Errorf("datadog-connector: API key not valid")
+	if !validation.GetValid() {
+		return nil, status.Error(codes.Unauthenticated, "datadog-connector: API key not valid")
+	}
+
+	err = d.validateReadAccess(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case d.readOnly:
+		d.warnWriteScopes(ctx)
+	case d.provisioning:
+		err = d.validateProvisioningScopes(ctx)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return nil, nil
 }
 
+// validateReadAccess lists a single item of users, roles and teams, which exercises the application key and the read
+// scopes a sync needs before the sync itself fails halfway through. The other resource types are skipped by the sync
+// when the key cannot read them, the ones that will be are logged.
+func (d *Datadog) validateReadAccess(ctx context.Context) error {
+	usersApi := datadogV2.NewUsersApi(d.client.api)
+	_, resp, err := usersApi.ListUsers(ctx, *datadogV2.NewListUsersOptionalParameters().WithPageSize(1))
+	if err != nil {
+		return wrapError(err, resp, "datadog-connector: failed to read users, the application key needs the user_access_read scope")
+	}
+
+	rolesApi := datadogV2.NewRolesApi(d.client.api)
+	_, resp, err = rolesApi.ListRoles(ctx, *datadogV2.NewListRolesOptionalParameters().WithPageSize(1))
+	if err != nil {
+		return wrapError(err, resp, "datadog-connector: failed to read roles, the application key needs the user_access_read scope")
+	}
+
+	teamsApi := datadogV2.NewTeamsApi(d.client.api)
+	_, resp, err = teamsApi.ListTeams(ctx, *datadogV2.NewListTeamsOptionalParameters().WithPageSize(1))
+	if err != nil {
+		return wrapError(err, resp, "datadog-connector: failed to read teams, the application key needs the teams_read scope")
+	}
+
+	d.warnSkippedResources(ctx)
+
+	return nil
+}
+
+// optionalReadCheck reads a single item of resources the sync skips when the key is not allowed to read them.
+type optionalReadCheck struct {
+	resources string
+	read      func(ctx context.Context, client *client) (*http.Response, error)
+}
+
+var optionalReadChecks = []optionalReadCheck{
+	{resources: "logs archives", read: func(ctx context.Context, client *client) (*http.Response, error) {
+		_, resp, err := datadogV2.NewLogsArchivesApi(client.api).ListLogsArchives(ctx)
+		return resp, err
+	}},
+	{resources: "Synthetics global variables", read: func(ctx context.Context, client *client) (*http.Response, error) {
+		_, resp, err := datadogV1.NewSyntheticsApi(client.api).ListGlobalVariables(ctx)
+		return resp, err
+	}},
+	{resources: "Synthetics private locations", read: func(ctx context.Context, client *client) (*http.Response, error) {
+		_, resp, err := datadogV1.NewSyntheticsApi(client.api).ListLocations(ctx)
+		return resp, err
+	}},
+	{resources: "Synthetics tests", read: func(ctx context.Context, client *client) (*http.Response, error) {
+		_, resp, err := datadogV1.NewSyntheticsApi(client.api).ListTests(ctx, *datadogV1.NewListTestsOptionalParameters().WithPageSize(1))
+		return resp, err
+	}},
+	{resources: "Service Catalog services", read: func(ctx context.Context, client *client) (*http.Response, error) {
+		_, resp, err := datadogV2.NewServiceDefinitionApi(client.api).ListServiceDefinitions(ctx, *datadogV2.NewListServiceDefinitionsOptionalParameters().WithPageSize(1))
+		return resp, err
+	}},
+	{resources: "AWS integration accounts", read: func(ctx context.Context, client *client) (*http.Response, error) {
+		_, resp, err := datadogV1.NewAWSIntegrationApi(client.api).ListAWSAccounts(ctx)
+		return resp, err
+	}},
+	{resources: "GCP integration accounts", read: func(ctx context.Context, client *client) (*http.Response, error) {
+		_, resp, err := datadogV1.NewGCPIntegrationApi(client.api).ListGCPIntegration(ctx)
+		return resp, err
+	}},
+	{resources: "Azure integration accounts", read: func(ctx context.Context, client *client) (*http.Response, error) {
+		_, resp, err := datadogV1.NewAzureIntegrationApi(client.api).ListAzureIntegration(ctx)
+		return resp, err
+	}},
+	{resources: "Security Monitoring rules", read: func(ctx context.Context, client *client) (*http.Response, error) {
+		_, resp, err := datadogV2.NewSecurityMonitoringApi(client.api).ListSecurityMonitoringRules(ctx, *datadogV2.NewListSecurityMonitoringRulesOptionalParameters().WithPageSize(1))
+		return resp, err
+	}},
+	{resources: "security filters", read: func(ctx context.Context, client *client) (*http.Response, error) {
+		_, resp, err := datadogV2.NewSecurityMonitoringApi(client.api).ListSecurityFilters(ctx)
+		return resp, err
+	}},
+	{resources: "Sensitive Data Scanner groups and rules", read: func(ctx context.Context, client *client) (*http.Response, error) {
+		_, resp, err := datadogV2.NewSensitiveDataScannerApi(client.api).ListScanningGroups(ctx)
+		return resp, err
+	}},
+	{resources: "the IP allowlist", read: func(ctx context.Context, client *client) (*http.Response, error) {
+		_, resp, err := datadogV2.NewIPAllowlistApi(client.api).GetIPAllowlist(ctx)
+		return resp, err
+	}},
+	{resources: "incident teams", read: func(ctx context.Context, client *client) (*http.Response, error) {
+		_, resp, err := datadogV2.NewIncidentTeamsApi(client.api).ListIncidentTeams(ctx, *datadogV2.NewListIncidentTeamsOptionalParameters().WithPageSize(1))
+		return resp, err
+	}},
+	{resources: "incident services", read: func(ctx context.Context, client *client) (*http.Response, error) {
+		_, resp, err := datadogV2.NewIncidentServicesApi(client.api).ListIncidentServices(ctx, *datadogV2.NewListIncidentServicesOptionalParameters().WithPageSize(1))
+		return resp, err
+	}},
+}
+
+// warnSkippedResources reads a single item of every resource type the sync skips when the key is not allowed
+// to read it, and logs the ones that will be skipped.
+func (d *Datadog) warnSkippedResources(ctx context.Context) {
+	l := ctxzap.Extract(ctx)
+
+	for _, check := range optionalReadChecks {
+		resp, err := check.read(ctx, d.client)
+		switch {
+		case err == nil:
+		case hasStatus(resp, http.StatusForbidden):
+			l.Warn("baton-datadog: not allowed to read resources, the sync will skip them", zap.String("resources", check.resources), zap.Error(err))
+		default:
+			l.Warn("baton-datadog: unable to check read access to resources", zap.String("resources", check.resources), zap.Error(err))
+		}
+	}
+}
+
+// validateProvisioningScopes returns an error listing the scopes required for provisioning that the application key
+// lacks, and warns about the optional scopes it lacks. Keys without scopes act with the permissions of their owner,
+// so those are checked instead.
+func (d *Datadog) validateProvisioningScopes(ctx context.Context) error {
+	l := ctxzap.Extract(ctx)
+
+	scopes, err := getAppKeyScopes(ctx, d.client)
+	if err != nil {
+		return fmt.Errorf("datadog-connector: unable to verify application key scopes for provisioning: %w", err)
+	}
+
+	if !scopes.Restricted {
+		permissions, err := getUserPermissions(ctx, d.client, scopes.OwnerID)
+		if err != nil {
+			return fmt.Errorf("datadog-connector: unable to verify application key owner permissions for provisioning: %w", err)
+		}
+		scopes = &appKeyScopes{Restricted: true, Scopes: permissions}
+	}
+
+	missing := scopes.Missing(provisioningScopes)
+	if len(missing) != 0 {
+		return status.Errorf(
+			codes.PermissionDenied,
+			"datadog-connector: provisioning is enabled but the application key is missing the %s permissions",
+			strings.Join(missing, ", "),
+		)
+	}
+
+	for _, optional := range optionalProvisioningScopes {
+		if !scopes.Has(optional.scope) {
+			l.Warn(
+				"baton-datadog: the application key is missing an optional provisioning permission, provisioning these resources will fail",
+				zap.String("permission", optional.scope),
+				zap.String("resources", optional.resources),
+			)
+		}
+	}
+
+	return nil
+}
+
+// warnWriteScopes logs a warning when the application key would allow changes in Datadog,
+// since a read-only connector should be given a key that cannot mutate access even if misconfigured.
+func (d *Datadog) warnWriteScopes(ctx context.Context) {
+	l := ctxzap.Extract(ctx)
+
+	scopes, err := getAppKeyScopes(ctx, d.client)
+	if err != nil {
+		l.Warn("baton-datadog: unable to verify application key scopes in read-only mode", zap.Error(err))
+		return
+	}
+
+	if !scopes.Restricted {
+		l.Warn("baton-datadog: running in read-only mode with an unscoped application key, it has every permission of its owner including write access")
+		return
+	}
+
+	if writeScopes := scopes.WriteScopes(); len(writeScopes) != 0 {
+		l.Warn("baton-datadog: running in read-only mode with an application key that has write scopes", zap.Strings("scopes", writeScopes))
+	}
+}
+
+// Config configures the connector.
+type Config struct {
+	// Site is the Datadog site, such as datadoghq.com. BaseURL, when set, replaces the API server derived from it.
+	Site    string
+	BaseURL string
+	// A key file, when given, is used instead of the key and re-read whenever it changes.
+	APIKey     string
+	AppKey     string
+	APIKeyFile string
+	AppKeyFile string
+	// Provisioning enables granting and revoking entitlements. ReadOnly and DryRun keep it from changing Datadog.
+	Provisioning bool
+	ReadOnly     bool
+	DryRun       bool
+	// With a positive GrantConcurrency, the memberships of that many teams and roles are fetched at once
+	// in the background as soon as they are listed.
+	GrantConcurrency int
+	// The PagerDuty services, Slack accounts and webhooks of the given names are synced along with the other
+	// integration accounts, since Datadog cannot list them.
+	PagerDutyServices []string
+	SlackAccounts     []string
+	Webhooks          []string
+	// IPAllowlistEntries, CIDR blocks or IP addresses optionally followed by =note, are synced as IP allowlist
+	// entries even when missing from the allowlist, so they can be added to it.
+	IPAllowlistEntries []string
+}
+
 // New returns a new instance of the connector.
-func New(ctx context.Context, site, apiKey, appKey string) (*Datadog, error) {
-	httpClient, err := uhttp.NewClient(ctx, uhttp.WithLogger(true, ctxzap.Extract(ctx)))
+// Background grant prefetching runs with ctx, which must live as long as the connector.
+func New(ctx context.Context, cfg Config) (*Datadog, error) {
+	entries, err := parseIPAllowlistEntries(cfg.IPAllowlistEntries)
 	if err != nil {
 		return nil, err
 	}
 
-	conf := datadog.NewConfiguration()
-	conf.HTTPClient = httpClient
+	creds, err := newCredentials(cfg.APIKey, cfg.AppKey, cfg.APIKeyFile, cfg.AppKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newClient(ctx, cfg.Site, cfg.BaseURL, creds)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Datadog{
-		site:   site,
-		apiKey: apiKey,
-		appKey: appKey,
-		client: datadog.NewAPIClient(conf),
+		client:             c,
+		rolePermissions:    newRolePermissions(),
+		teamMappings:       newTeamMappings(),
+		userIndex:          newUserIndex(),
+		teamIndex:          newTeamIndex(),
+		scannerConfig:      newScannerConfiguration(),
+		prefetcher:         newPrefetcher(ctx, cfg.GrantConcurrency),
+		integrationSources: namedIntegrationAccountSources(cfg.PagerDutyServices, cfg.SlackAccounts, cfg.Webhooks),
+		ipAllowlistEntries: entries,
+		provisioning:       cfg.Provisioning,
+		readOnly:           cfg.ReadOnly,
+		dryRun:             cfg.DryRun,
 	}, nil
 }
@@ -0,0 +1,1446 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// seedFakeDatadog fills the fake with a small organization: four users over three roles,
+// three teams of which one is managed by a SAML mapping, and non-default team permission settings.
+func seedFakeDatadog(f *fakeDatadog) {
+	f.permissions = []fakePermission{
+		{ID: "p-user-access", Name: "user_access_manage"},
+		{ID: "p-teams", Name: "teams_manage"},
+		{ID: "p-logs", Name: "logs_read_data"},
+		{ID: "p-logs-archives", Name: "logs_write_archives"},
+		{ID: "p-aws", Name: "aws_configurations_manage"},
+		{ID: "p-security-rules", Name: "security_monitoring_rules_write"},
+		{ID: "p-scanner", Name: "data_scanner_write"},
+		{ID: "p-org", Name: "org_management"},
+	}
+	f.roles = []*fakeRole{
+		{ID: "r-admin", Name: "Datadog Admin Role", Permissions: []string{"p-user-access", "p-teams", "p-logs", "p-logs-archives", "p-aws", "p-scanner", "p-org"}},
+		{ID: "r-std", Name: "Datadog Standard Role", Permissions: []string{"p-logs", "p-security-rules"}},
+		{ID: "r-ro", Name: "Datadog Read Only Role"},
+	}
+	f.users = []*fakeUser{
+		{ID: "u-alice", Name: "Alice Admin", Email: "alice@example.com", Status: "Active", Roles: []string{"r-admin"}},
+		{ID: "u-bob", Name: "Bob Builder", Email: "bob@example.com", Status: "Active", Roles: []string{"r-std"}},
+		{ID: "u-carol", Name: "Carol Gone", Email: "carol@example.com", Status: "Disabled", Roles: []string{"r-std"}},
+		{ID: "u-ci", Name: "CI Bot", Email: "ci@example.com", Status: "Active", ServiceAccount: true, Roles: []string{"r-ro"}},
+	}
+	f.teams = []*fakeTeam{
+		{
+			ID:          "t-platform",
+			Name:        "Platform",
+			Handle:      "platform",
+			Description: "Platform engineering",
+			Links: []fakeTeamLink{
+				{ID: "l-runbook", Label: "Runbook", URL: "https://example.com/runbook"},
+				{ID: "l-chat", Label: "Chat", URL: "http://chat.internal/platform"},
+			},
+			Memberships: []fakeMembership{{UserID: "u-alice", Admin: true}, {UserID: "u-bob"}},
+			Permissions: map[string]string{"manage_membership": "members", "edit": "user_access_manage"},
+		},
+		{
+			ID:          "t-sre",
+			Name:        "SRE",
+			Handle:      "sre",
+			Memberships: []fakeMembership{{UserID: "u-carol"}},
+		},
+		{
+			ID:     "t-data",
+			Name:   "Data",
+			Handle: "data",
+		},
+	}
+	f.mappings = []fakeMapping{
+		{ID: "m-sre", AttributeKey: "department", AttributeValue: "sre", TeamID: "t-sre"},
+	}
+	f.archives = []*fakeArchive{
+		{ID: "a-audit", Name: "Audit", Query: "source:audit", Bucket: "audit-logs", ReadRoles: []string{"r-admin"}},
+		{ID: "a-all", Name: "Everything", Query: "*", Bucket: "all-logs"},
+	}
+	f.variables = []*fakeGlobalVariable{
+		{ID: "v-token", Name: "API_TOKEN", Secure: true, RestrictedRoles: []string{"r-admin"}},
+		{ID: "v-url", Name: "BASE_URL"},
+	}
+	f.locations = []*fakePrivateLocation{
+		{ID: "pl:office", Name: "Office", RestrictedRoles: []string{"r-std"}},
+	}
+	f.services = []*fakeService{
+		{Name: "payments-api", Team: "Platform", Tier: "critical", Contacts: []string{"payments@example.com"}},
+		{Name: "legacy-batch", Team: "gone-team", Tier: "low"},
+	}
+	f.aws = []*fakeCloudAccount{{ID: "123456789012", Name: "DatadogIntegrationRole"}}
+	f.gcp = []*fakeCloudAccount{{ID: "datadog@acme-prod.iam.gserviceaccount.com", Name: "acme-prod"}}
+	f.azure = []*fakeCloudAccount{{ID: "c-azure", Name: "t-azure"}}
+	f.integrations = map[string][]*fakeCloudAccount{
+		"/api/v2/integrations/cloudflare/accounts": {{ID: "cf-1", Name: "acme-cdn"}},
+		"/api/v2/integration/opsgenie/services":    {{ID: "og-1", Name: "oncall"}},
+	}
+	f.securityRules = []*fakeSecurityRule{
+		{ID: "sr-brute-force", Name: "Brute force", Type: "log_detection", Enabled: true, IsDefault: true},
+		{ID: "sr-impossible-travel", Name: "Impossible travel", Type: "signal_correlation", Creator: "bob@example.com"},
+		{ID: "sr-removed", Name: "Removed", Type: "log_detection", Deleted: true},
+	}
+	f.scannerGroups = []*fakeScannerGroup{
+		{ID: "sg-pii", Name: "PII", Enabled: true, Rules: []string{"card-numbers", "emails"}},
+		{ID: "sg-empty", Name: "Empty"},
+	}
+	f.ipAllowlistEnabled = true
+	f.ipAllowlist = []fakeIPAllowlistEntry{
+		{CIDR: "10.0.0.0/8", Note: "Office VPN"},
+		{CIDR: "203.0.113.7", Note: "CI runner"},
+	}
+	f.incidentTeams = map[string]string{"it-platform": "platform", "it-security": "Security", "it-sre": "SRE"}
+	f.incidentServices = map[string]string{"is-data": "Data", "is-payments": "Payments"}
+	f.tests = []*fakeSyntheticsTest{
+		{PublicID: "st-login", Name: "Login", Type: "api", Status: "live", MonitorID: 101, CreatorEmail: "alice@example.com", RestrictedRoles: []string{"r-admin"}},
+		{PublicID: "st-checkout", Name: "Checkout", Type: "browser", Status: "paused", MonitorID: 102, CreatorEmail: "gone@example.com"},
+	}
+}
+
+// newTestConnector returns a connector talking to the fake Datadog API.
+func newTestConnector(t *testing.T, f *fakeDatadog, readOnly, dryRun bool) *Datadog {
+	t.Helper()
+
+	d, err := New(context.Background(), Config{Site: "datadoghq.com", BaseURL: f.URL(), APIKey: fakeAPIKey, AppKey: fakeAppKey, ReadOnly: readOnly, DryRun: dryRun})
+	if err != nil {
+		t.Fatalf("creating connector: %v", err)
+	}
+	// The fake API is not rate limited, pacing requests would only slow the tests down.
+	d.client.limiter.interval = 0
+
+	return d
+}
+
+type syncResult struct {
+	resources    map[string]*v2.Resource
+	entitlements map[string]*v2.Entitlement
+	grants       map[string]*v2.Grant
+}
+
+// fullSync lists every resource, entitlement and grant of the connector the way the SDK syncer does,
+// following page tokens until they run out.
+func fullSync(t *testing.T, ctx context.Context, d *Datadog) *syncResult {
+	t.Helper()
+
+	rv := &syncResult{
+		resources:    make(map[string]*v2.Resource),
+		entitlements: make(map[string]*v2.Entitlement),
+		grants:       make(map[string]*v2.Grant),
+	}
+
+	syncers := make(map[string]connectorbuilder.ResourceSyncer)
+	for _, syncer := range d.ResourceSyncers(ctx) {
+		syncers[syncer.ResourceType(ctx).Id] = syncer
+	}
+
+	// Resource types are synced in order, child resources right after their parent as the syncer does.
+	var syncResources func(syncer connectorbuilder.ResourceSyncer, parentResourceID *v2.ResourceId)
+	syncResources = func(syncer connectorbuilder.ResourceSyncer, parentResourceID *v2.ResourceId) {
+		var resources []*v2.Resource
+		token := ""
+		for {
+			page, next, _, err := syncer.List(ctx, parentResourceID, &pagination.Token{Token: token})
+			if err != nil {
+				t.Fatalf("listing %s resources: %v", syncer.ResourceType(ctx).Id, err)
+			}
+			resources = append(resources, page...)
+			if next == "" {
+				break
+			}
+			token = next
+		}
+
+		for _, resource := range resources {
+			rv.resources[resourceKey(resource.Id)] = resource
+
+			token = ""
+			for {
+				page, next, _, err := syncer.Entitlements(ctx, resource, &pagination.Token{Token: token})
+				if err != nil {
+					t.Fatalf("listing entitlements of %s: %v", resourceKey(resource.Id), err)
+				}
+				for _, e := range page {
+					rv.entitlements[e.Id] = e
+				}
+				if next == "" {
+					break
+				}
+				token = next
+			}
+
+			token = ""
+			for {
+				page, next, _, err := syncer.Grants(ctx, resource, &pagination.Token{Token: token})
+				if err != nil {
+					t.Fatalf("listing grants of %s: %v", resourceKey(resource.Id), err)
+				}
+				for _, g := range page {
+					rv.grants[grantKey(g)] = g
+				}
+				if next == "" {
+					break
+				}
+				token = next
+			}
+
+			for _, a := range resource.Annotations {
+				childType := &v2.ChildResourceType{}
+				if a.UnmarshalTo(childType) == nil {
+					syncResources(syncers[childType.ResourceTypeId], resource.Id)
+				}
+			}
+		}
+	}
+
+	for _, syncer := range d.ResourceSyncers(ctx) {
+		syncResources(syncer, nil)
+	}
+
+	return rv
+}
+
+func resourceKey(id *v2.ResourceId) string {
+	return id.ResourceType + ":" + id.Resource
+}
+
+func grantKey(g *v2.Grant) string {
+	return g.Entitlement.Id + " -> " + resourceKey(g.Principal.Id)
+}
+
+func sortedKeys(grants map[string]*v2.Grant) []string {
+	keys := make([]string, 0, len(grants))
+	for key := range grants {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func provisionerFor(t *testing.T, ctx context.Context, d *Datadog, resourceType *v2.ResourceType) connectorbuilder.ResourceProvisioner {
+	t.Helper()
+
+	for _, syncer := range d.ResourceSyncers(ctx) {
+		if syncer.ResourceType(ctx).Id != resourceType.Id {
+			continue
+		}
+		provisioner, ok := syncer.(connectorbuilder.ResourceProvisioner)
+		if !ok {
+			t.Fatalf("%s builder does not support provisioning", resourceType.Id)
+		}
+		return provisioner
+	}
+
+	t.Fatalf("no builder for resource type %s", resourceType.Id)
+	return nil
+}
+
+func grantMetadata(t *testing.T, annos annotations.Annotations) map[string]interface{} {
+	t.Helper()
+
+	md := &v2.GrantMetadata{}
+	ok, err := annos.Pick(md)
+	if err != nil {
+		t.Fatalf("reading grant metadata: %v", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	return md.Metadata.AsMap()
+}
+
+func assertCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("expected an error with code %s, got none", code)
+	}
+	if got := status.Code(err); got != code {
+		t.Fatalf("expected an error with code %s, got %s: %v", code, got, err)
+	}
+}
+
+func userPrincipal(id string) *v2.Resource {
+	return &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: id}}
+}
+
+func teamResourceFor(id string) *v2.Resource {
+	return &v2.Resource{Id: &v2.ResourceId{ResourceType: teamResourceType.Id, Resource: id}, DisplayName: id}
+}
+
+func roleResourceFor(id string) *v2.Resource {
+	return &v2.Resource{Id: roleResourceID(id), DisplayName: id}
+}
+
+// grantFor returns a grant of the entitlement to the principal, as the SDK passes it to Revoke.
+func grantFor(entitlement *v2.Entitlement, principal *v2.Resource) *v2.Grant {
+	g := grant.NewGrant(entitlement.Resource, entitlement.Slug, principal.Id)
+	g.Entitlement = entitlement
+
+	return g
+}
+
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+
+	d := newTestConnector(t, f, false, false)
+	if _, err := d.Validate(ctx); err != nil {
+		t.Fatalf("validating connector: %v", err)
+	}
+
+	f.apiKey = "rotated-api-key"
+	_, err := d.Validate(ctx)
+	assertCode(t, err, codes.PermissionDenied)
+}
+
+func TestKeyFileRotation(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+
+	dir := t.TempDir()
+	apiKeyFile := filepath.Join(dir, "api-key")
+	appKeyFile := filepath.Join(dir, "app-key")
+	writeKeyFile(t, apiKeyFile, fakeAPIKey+"\n", time.Now().Add(-time.Hour))
+	writeKeyFile(t, appKeyFile, fakeAppKey+"\n", time.Now().Add(-time.Hour))
+
+	d, err := New(ctx, Config{Site: "datadoghq.com", BaseURL: f.URL(), APIKeyFile: apiKeyFile, AppKeyFile: appKeyFile})
+	if err != nil {
+		t.Fatalf("creating connector: %v", err)
+	}
+	d.client.limiter.interval = 0
+	if _, err = d.Validate(ctx); err != nil {
+		t.Fatalf("validating connector with key files: %v", err)
+	}
+
+	// A changed file is picked up before the next request.
+	f.apiKey = "rotated-api-key"
+	writeKeyFile(t, apiKeyFile, f.apiKey, time.Now())
+	if _, err = d.Validate(ctx); err != nil {
+		t.Fatalf("validating connector after rotating the API key: %v", err)
+	}
+
+	// A rotation the modification time does not reveal is picked up when Datadog rejects the old key.
+	f.appKey = "rotated-app-key"
+	info, err := os.Stat(appKeyFile)
+	if err != nil {
+		t.Fatalf("reading key file: %v", err)
+	}
+	writeKeyFile(t, appKeyFile, f.appKey, info.ModTime())
+	if _, _, _, err = d.ResourceSyncers(ctx)[0].List(ctx, nil, &pagination.Token{}); err != nil {
+		t.Fatalf("listing users after rotating the application key: %v", err)
+	}
+}
+
+func writeKeyFile(t *testing.T, path, key string, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(key), 0o600); err != nil {
+		t.Fatalf("writing key file: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("setting key file modification time: %v", err)
+	}
+}
+
+func TestValidateProvisioningScopes(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+
+	d, err := New(ctx, Config{Site: "datadoghq.com", BaseURL: f.URL(), APIKey: fakeAPIKey, AppKey: fakeAppKey, Provisioning: true})
+	if err != nil {
+		t.Fatalf("creating connector: %v", err)
+	}
+	d.client.limiter.interval = 0
+
+	f.appKeyScopes = []string{"user_access_read", "user_access_manage", "teams_read"}
+	_, err = d.Validate(ctx)
+	assertCode(t, err, codes.PermissionDenied)
+	if !strings.Contains(err.Error(), "teams_manage") || strings.Contains(err.Error(), "user_access_manage") {
+		t.Errorf("expected only teams_manage to be reported missing, got %v", err)
+	}
+
+	// The scopes of logs archive readers and IP allowlist entries are optional, keys provisioning only roles
+	// and teams are accepted without them.
+	f.appKeyScopes = append(f.appKeyScopes, "teams_manage")
+	if _, err = d.Validate(ctx); err != nil {
+		t.Errorf("expected a key with the provisioning scopes to validate: %v", err)
+	}
+
+	// Unscoped keys act with the permissions of their owner.
+	f.appKeyScopes = nil
+	f.appKeyOwner = "u-bob"
+	_, err = d.Validate(ctx)
+	assertCode(t, err, codes.PermissionDenied)
+	if !strings.Contains(err.Error(), "user_access_manage, teams_manage") || strings.Contains(err.Error(), "org_management") {
+		t.Errorf("expected every required provisioning permission to be reported missing, got %v", err)
+	}
+
+	f.appKeyOwner = "u-alice"
+	if _, err = d.Validate(ctx); err != nil {
+		t.Errorf("expected an unscoped key of an admin to validate: %v", err)
+	}
+}
+
+func TestValidateReadAccess(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	f.failNext(http.MethodGet, "/api/v2/team", http.StatusForbidden, "Forbidden")
+
+	_, err := newTestConnector(t, f, false, false).Validate(ctx)
+	assertCode(t, err, codes.PermissionDenied)
+	if !strings.Contains(err.Error(), "teams_read") {
+		t.Errorf("expected the error to name the missing scope, got %v", err)
+	}
+}
+
+func TestValidateSkippedResources(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	f.failNext(http.MethodGet, "/api/v2/logs/config/archives", http.StatusForbidden, "Forbidden")
+
+	// Resource types the sync skips when they cannot be read are checked, without failing the validation.
+	if _, err := newTestConnector(t, f, false, false).Validate(ctx); err != nil {
+		t.Fatalf("expected unreadable logs archives not to fail the validation: %v", err)
+	}
+	for _, request := range []string{"GET /api/v2/logs/config/archives", "GET /api/v2/ip_allowlist", "GET /api/v2/security_monitoring/rules"} {
+		if f.requestCount(request) != 1 {
+			t.Errorf("expected read access to be checked with %s", request)
+		}
+	}
+}
+
+func TestFullSync(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+
+	result := fullSync(t, ctx, newTestConnector(t, f, false, false))
+
+	var resourceKeys []string
+	for key := range result.resources {
+		resourceKeys = append(resourceKeys, key)
+	}
+	sort.Strings(resourceKeys)
+	expectedResources := []string{
+		"aws_account:123456789012",
+		"azure_account:t-azure/c-azure",
+		"gcp_account:datadog@acme-prod.iam.gserviceaccount.com",
+		"incident_service:is-data", "incident_service:is-payments",
+		"incident_team:it-platform", "incident_team:it-security", "incident_team:it-sre",
+		"integration_account:Cloudflare:cf-1", "integration_account:Opsgenie:og-1",
+		"ip_allowlist:ip_allowlist",
+		"ip_allowlist_entry:10.0.0.0/8", "ip_allowlist_entry:203.0.113.7/32",
+		"logs_archive:a-all", "logs_archive:a-audit",
+		"role:r-admin", "role:r-ro", "role:r-std",
+		"sds_group:sg-empty", "sds_group:sg-pii",
+		"sds_rule:card-numbers", "sds_rule:emails",
+		"security_filter:sf-logs",
+		"security_monitoring_rule:sr-brute-force", "security_monitoring_rule:sr-impossible-travel",
+		"service:legacy-batch", "service:payments-api",
+		"synthetics_global_variable:v-token", "synthetics_global_variable:v-url",
+		"synthetics_private_location:pl:office",
+		"synthetics_test:st-checkout", "synthetics_test:st-login",
+		"team:t-data", "team:t-platform", "team:t-sre",
+		"user:u-alice", "user:u-bob", "user:u-carol", "user:u-ci",
+	}
+	if !reflect.DeepEqual(resourceKeys, expectedResources) {
+		t.Fatalf("unexpected resources\n got: %v\nwant: %v", resourceKeys, expectedResources)
+	}
+
+	carol, err := rs.GetUserTrait(result.resources["user:u-carol"])
+	if err != nil {
+		t.Fatalf("reading user trait: %v", err)
+	}
+	if carol.Status.Status != v2.UserTrait_Status_STATUS_DISABLED {
+		t.Errorf("expected disabled user to have status disabled, got %s", carol.Status.Status)
+	}
+	ci, err := rs.GetUserTrait(result.resources["user:u-ci"])
+	if err != nil {
+		t.Fatalf("reading user trait: %v", err)
+	}
+	if ci.AccountType != v2.UserTrait_ACCOUNT_TYPE_SERVICE {
+		t.Errorf("expected service account to have account type service, got %s", ci.AccountType)
+	}
+
+	platform := result.resources["team:t-platform"]
+	platformTrait, err := rs.GetGroupTrait(platform)
+	if err != nil {
+		t.Fatalf("reading group trait: %v", err)
+	}
+	if handle := platformTrait.Profile.Fields["team_handle"].GetStringValue(); handle != "platform" {
+		t.Errorf("expected team handle platform, got %q", handle)
+	}
+	var links []string
+	for _, a := range platform.Annotations {
+		link := &v2.ExternalLink{}
+		if a.MessageIs(link) {
+			if err := a.UnmarshalTo(link); err != nil {
+				t.Fatalf("reading external link: %v", err)
+			}
+			links = append(links, link.Url)
+		}
+	}
+	if !reflect.DeepEqual(links, []string{"https://example.com/runbook"}) {
+		t.Errorf("expected only the https team link as external link, got %v", links)
+	}
+	if other := platformTrait.Profile.AsMap()["other_links"]; !reflect.DeepEqual(other, []interface{}{"http://chat.internal/platform"}) {
+		t.Errorf("expected the non-https team link in the profile, got %v", other)
+	}
+
+	for _, id := range []string{
+		"role:r-std:member",
+		"team:t-platform:member",
+		"team:t-platform:admin",
+		"team:t-platform:manage_membership_organization",
+		"team:t-platform:edit_user_access_manage",
+	} {
+		if _, ok := result.entitlements[id]; !ok {
+			t.Errorf("missing entitlement %s", id)
+		}
+	}
+	sreMember := result.entitlements["team:t-sre:member"]
+	if sreMember == nil || !strings.Contains(sreMember.Description, "department=sre") {
+		t.Errorf("expected the SRE member entitlement to name its SAML mapping, got %v", sreMember)
+	}
+
+	var grantKeys []string
+	for key := range result.grants {
+		grantKeys = append(grantKeys, key)
+	}
+	sort.Strings(grantKeys)
+	expectedGrants := []string{
+		"aws_account:123456789012:manager -> role:r-admin",
+		"incident_service:is-data:member -> team:t-data",
+		"incident_team:it-platform:member -> team:t-platform",
+		"incident_team:it-sre:member -> team:t-sre",
+		"ip_allowlist:ip_allowlist:entry -> ip_allowlist_entry:10.0.0.0/8",
+		"ip_allowlist:ip_allowlist:entry -> ip_allowlist_entry:203.0.113.7/32",
+		"logs_archive:a-audit:reader -> role:r-admin",
+		"role:r-admin:member -> user:u-alice",
+		"role:r-ro:member -> user:u-ci",
+		"role:r-std:member -> user:u-bob",
+		"role:r-std:member -> user:u-carol",
+		"sds_group:sg-empty:editor -> role:r-admin",
+		"sds_group:sg-pii:editor -> role:r-admin",
+		"sds_rule:card-numbers:editor -> role:r-admin",
+		"sds_rule:emails:editor -> role:r-admin",
+		"security_monitoring_rule:sr-brute-force:editor -> role:r-std",
+		"security_monitoring_rule:sr-impossible-travel:editor -> role:r-std",
+		"security_monitoring_rule:sr-impossible-travel:owner -> user:u-bob",
+		"service:payments-api:owner -> team:t-platform",
+		"synthetics_global_variable:v-token:editor -> role:r-admin",
+		"synthetics_global_variable:v-url:editor -> role:r-admin",
+		"synthetics_global_variable:v-url:editor -> role:r-ro",
+		"synthetics_global_variable:v-url:editor -> role:r-std",
+		"synthetics_private_location:pl:office:editor -> role:r-std",
+		"synthetics_test:st-checkout:editor -> role:r-admin",
+		"synthetics_test:st-checkout:editor -> role:r-ro",
+		"synthetics_test:st-checkout:editor -> role:r-std",
+		"synthetics_test:st-login:editor -> role:r-admin",
+		"synthetics_test:st-login:owner -> user:u-alice",
+		"team:t-data:edit_admins -> team:t-data",
+		"team:t-data:manage_membership_admins -> team:t-data",
+		"team:t-platform:admin -> user:u-alice",
+		"team:t-platform:edit_user_access_manage -> team:t-platform",
+		"team:t-platform:manage_membership_members -> team:t-platform",
+		"team:t-platform:member -> user:u-alice",
+		"team:t-platform:member -> user:u-bob",
+		"team:t-sre:edit_admins -> team:t-sre",
+		"team:t-sre:manage_membership_admins -> team:t-sre",
+		"team:t-sre:member -> user:u-carol",
+	}
+	if !reflect.DeepEqual(grantKeys, expectedGrants) {
+		t.Fatalf("unexpected grants\n got: %v\nwant: %v", grantKeys, expectedGrants)
+	}
+
+	expandable := &v2.GrantExpandable{}
+	settingAnnos := annotations.Annotations(result.grants["team:t-platform:edit_user_access_manage -> team:t-platform"].Annotations)
+	if ok, err := settingAnnos.Pick(expandable); err != nil || !ok {
+		t.Fatalf("expected permission setting grant to be expandable, err: %v", err)
+	}
+	if !reflect.DeepEqual(expandable.EntitlementIds, []string{"role:r-admin:member"}) {
+		t.Errorf("expected permission setting grant to expand to the role members, got %v", expandable.EntitlementIds)
+	}
+
+	sreGrant := result.grants["team:t-sre:member -> user:u-carol"]
+	if md := grantMetadata(t, sreGrant.Annotations); md["idp_managed"] != true {
+		t.Errorf("expected SAML managed membership to be marked idp_managed, got %v", md)
+	}
+
+	payments, err := rs.GetAppTrait(result.resources["service:payments-api"])
+	if err != nil {
+		t.Fatalf("reading app trait: %v", err)
+	}
+	if tier, _ := rs.GetProfileStringValue(payments.Profile, "tier"); tier != "critical" {
+		t.Errorf("expected service tier critical, got %q", tier)
+	}
+	ownerAnnos := annotations.Annotations(result.grants["service:payments-api:owner -> team:t-platform"].Annotations)
+	ownerExpandable := &v2.GrantExpandable{}
+	if ok, _ := ownerAnnos.Pick(ownerExpandable); !ok || len(ownerExpandable.EntitlementIds) != 1 || ownerExpandable.EntitlementIds[0] != "team:t-platform:member" {
+		t.Errorf("expected service owner grant to expand to the team members, got %v", ownerExpandable.EntitlementIds)
+	}
+
+	audit := appProfile(t, result.resources["logs_archive:a-audit"])
+	if audit["destination_type"] != "S3" || audit["destination"] != "audit-logs" || audit["query"] != "source:audit" || !reflect.DeepEqual(audit["read_roles"], []interface{}{"r-admin"}) {
+		t.Errorf("expected logs archive profile to carry its destination, query and read roles, got %v", audit)
+	}
+
+	if parent := result.resources["sds_rule:emails"].ParentResourceId; resourceKey(parent) != "sds_group:sg-pii" {
+		t.Errorf("expected Sensitive Data Scanner rule to be a child of its group, got %v", parent)
+	}
+	// The configuration holding all groups and rules is read once, not again for the rules of each group.
+	if got := f.requestCount("GET /api/v2/sensitive-data-scanner/config"); got != 1 {
+		t.Errorf("expected the Sensitive Data Scanner configuration to be read once, got %d requests", got)
+	}
+
+	incidentAnnos := annotations.Annotations(result.grants["incident_team:it-platform:member -> team:t-platform"].Annotations)
+	incidentExpandable := &v2.GrantExpandable{}
+	if ok, _ := incidentAnnos.Pick(incidentExpandable); !ok || !reflect.DeepEqual(incidentExpandable.EntitlementIds, []string{"team:t-platform:member"}) {
+		t.Errorf("expected incident team grant to expand to the members of the team of the same name, got %v", incidentExpandable.EntitlementIds)
+	}
+
+	vpn, err := rs.GetAppTrait(result.resources["ip_allowlist_entry:10.0.0.0/8"])
+	if err != nil {
+		t.Fatalf("reading app trait: %v", err)
+	}
+	if note, _ := rs.GetProfileStringValue(vpn.Profile, "note"); note != "Office VPN" {
+		t.Errorf("expected IP allowlist entry to carry its note, got %q", note)
+	}
+	allowlist, err := rs.GetAppTrait(result.resources["ip_allowlist:ip_allowlist"])
+	if err != nil {
+		t.Fatalf("reading app trait: %v", err)
+	}
+	if !allowlist.Profile.Fields["enabled"].GetBoolValue() {
+		t.Error("expected the IP allowlist to be flagged as enforced")
+	}
+
+	bruteForce, err := rs.GetAppTrait(result.resources["security_monitoring_rule:sr-brute-force"])
+	if err != nil {
+		t.Fatalf("reading app trait: %v", err)
+	}
+	if !bruteForce.Profile.Fields["is_default"].GetBoolValue() {
+		t.Error("expected the default Security Monitoring rule to be flagged as default")
+	}
+	if author, _ := rs.GetProfileInt64Value(bruteForce.Profile, "creation_author_id"); author != 42 {
+		t.Errorf("expected Security Monitoring rule to carry its creation author, got %d", author)
+	}
+
+	awsAccount, err := rs.GetAppTrait(result.resources["aws_account:123456789012"])
+	if err != nil {
+		t.Fatalf("reading app trait: %v", err)
+	}
+	if namespaces := awsAccount.Profile.Fields["namespace_overrides_enabled"].GetListValue().GetValues(); len(namespaces) != 1 || namespaces[0].GetStringValue() != "ec2" {
+		t.Errorf("expected only ec2 as enabled namespace override of the AWS account, got %v", namespaces)
+	}
+
+	checkout, err := rs.GetAppTrait(result.resources["synthetics_test:st-checkout"])
+	if err != nil {
+		t.Fatalf("reading app trait: %v", err)
+	}
+	if status, _ := rs.GetProfileStringValue(checkout.Profile, "status"); status != "paused" {
+		t.Errorf("expected paused Synthetics test to have status paused, got %q", status)
+	}
+	if monitorID, _ := rs.GetProfileInt64Value(checkout.Profile, "monitor_id"); monitorID != 102 {
+		t.Errorf("expected Synthetics test to carry its monitor ID, got %d", monitorID)
+	}
+
+	// Grants are built from the restricted roles recorded when listing, without fetching each resource again.
+	for request, want := range map[string]int{
+		"GET /api/v1/synthetics/variables/v-token":           0,
+		"GET /api/v1/synthetics/private-locations/pl:office": 1,
+	} {
+		if got := f.requestCount(request); got != want {
+			t.Errorf("expected %d %s requests, got %d", want, request, got)
+		}
+	}
+
+	openGrant := result.grants["synthetics_global_variable:v-url:editor -> role:r-std"]
+	if md := grantMetadata(t, openGrant.Annotations); md["restricted"] != false {
+		t.Errorf("expected grant of an unrestricted global variable to be marked unrestricted, got %v", md)
+	}
+}
+
+func TestPrefetchedGrants(t *testing.T) {
+	ctx := context.Background()
+	sequentialFake := newFakeDatadog(t)
+	seedFakeDatadog(sequentialFake)
+	sequential := fullSync(t, ctx, newTestConnector(t, sequentialFake, false, false))
+
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	d, err := New(ctx, Config{Site: "datadoghq.com", BaseURL: f.URL(), APIKey: fakeAPIKey, AppKey: fakeAppKey, GrantConcurrency: 4})
+	if err != nil {
+		t.Fatalf("creating connector: %v", err)
+	}
+	d.client.limiter.interval = 0
+	prefetched := fullSync(t, ctx, d)
+
+	if !reflect.DeepEqual(sortedKeys(prefetched.grants), sortedKeys(sequential.grants)) {
+		t.Fatalf("unexpected prefetched grants\n got: %v\nwant: %v", sortedKeys(prefetched.grants), sortedKeys(sequential.grants))
+	}
+
+	// Every page is fetched once, whether the prefetcher or Grants got to it first.
+	requests := []string{
+		"GET /api/v2/team/t-platform/memberships",
+		"GET /api/v2/roles/r-admin/users",
+	}
+	firstRun := make(map[string]int)
+	for _, request := range requests {
+		firstRun[request] = f.requestCount(request)
+		if got, want := firstRun[request], sequentialFake.requestCount(request); got != want {
+			t.Errorf("expected %d %s requests, got %d", want, request, got)
+		}
+	}
+
+	// A long-running connector syncs again with the same prefetcher, which must not hold on to the pages of
+	// the previous sync nor fetch them twice.
+	if results := len(d.prefetcher.results); results != 0 {
+		t.Errorf("expected every prefetched page to be released after the sync, %d left", results)
+	}
+	resynced := fullSync(t, ctx, d)
+	if !reflect.DeepEqual(sortedKeys(resynced.grants), sortedKeys(sequential.grants)) {
+		t.Fatalf("unexpected grants on the second sync\n got: %v\nwant: %v", sortedKeys(resynced.grants), sortedKeys(sequential.grants))
+	}
+	for _, request := range requests {
+		if got, want := f.requestCount(request)-firstRun[request], sequentialFake.requestCount(request); got != want {
+			t.Errorf("expected %d %s requests on the second sync, got %d", want, request, got)
+		}
+	}
+	if results := len(d.prefetcher.results); results != 0 {
+		t.Errorf("expected every prefetched page to be released after the second sync, %d left", results)
+	}
+}
+
+func TestPrefetchOutlivesList(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	d, err := New(ctx, Config{Site: "datadoghq.com", BaseURL: f.URL(), APIKey: fakeAPIKey, AppKey: fakeAppKey, GrantConcurrency: 4})
+	if err != nil {
+		t.Fatalf("creating connector: %v", err)
+	}
+	d.client.limiter.interval = 0
+	roles := newRoleBuilder(d.client, d.prefetcher, false, false)
+
+	// When the connector runs as a service the context of each call is cancelled as soon as it returns.
+	listCtx, cancel := context.WithCancel(ctx)
+	resources, _, _, err := roles.List(listCtx, nil, &pagination.Token{})
+	cancel()
+	if err != nil {
+		t.Fatalf("listing roles: %v", err)
+	}
+
+	// Both pages of the users of the role, the second one empty, are prefetched all the same.
+	const request = "GET /api/v2/roles/r-admin/users"
+	deadline := time.Now().Add(5 * time.Second)
+	for f.requestCount(request) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the users of the role to be prefetched after List returned, got %d requests", f.requestCount(request))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, resource := range resources {
+		if resource.Id.Resource != "r-admin" {
+			continue
+		}
+		token := &pagination.Token{}
+		for {
+			_, next, _, err := roles.Grants(ctx, resource, token)
+			if err != nil {
+				t.Fatalf("listing grants of the role: %v", err)
+			}
+			if next == "" {
+				break
+			}
+			token = &pagination.Token{Token: next}
+		}
+	}
+	if got := f.requestCount(request); got != 2 {
+		t.Errorf("expected the prefetched pages to be used, got %d requests", got)
+	}
+}
+
+func TestGrantsETag(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	d := newTestConnector(t, f, false, false)
+
+	// grants lists the grants of the resource the way the syncer does, following the page tokens and passing the
+	// ETag of the previous sync on the resource, and returns the grant keys and whether the previous grants are
+	// to be reused.
+	grants := func(resourceType *v2.ResourceType, resource *v2.Resource) ([]string, bool) {
+		t.Helper()
+
+		for _, syncer := range d.ResourceSyncers(ctx) {
+			if syncer.ResourceType(ctx).Id != resourceType.Id {
+				continue
+			}
+
+			var keys []string
+			var etag *v2.ETag
+			matched := false
+			token := &pagination.Token{}
+			for {
+				page, next, annos, err := syncer.Grants(ctx, resource, token)
+				if err != nil {
+					t.Fatalf("listing grants of %s: %v", resourceKey(resource.Id), err)
+				}
+				for _, g := range page {
+					keys = append(keys, grantKey(g))
+				}
+				matched = matched || annos.Contains(&v2.ETagMatch{})
+
+				pageETag := &v2.ETag{}
+				if ok, err := annos.Pick(pageETag); err == nil && ok {
+					if next != "" {
+						t.Fatalf("expected the ETag of %s on the last page only", resourceKey(resource.Id))
+					}
+					etag = pageETag
+				}
+
+				if next == "" {
+					break
+				}
+				token = &pagination.Token{Token: next}
+			}
+
+			if etag == nil {
+				t.Fatalf("expected an ETag for %s", resourceKey(resource.Id))
+			}
+			var resourceAnnos annotations.Annotations
+			resourceAnnos.Update(etag)
+			resource.Annotations = resourceAnnos
+
+			sort.Strings(keys)
+			return keys, matched
+		}
+
+		t.Fatalf("no syncer for %s", resourceType.Id)
+		return nil, false
+	}
+
+	// roleETag returns the ETag the last grants call left on the role.
+	roleETag := func(role *v2.Resource) string {
+		etag := &v2.ETag{}
+		roleAnnos := annotations.Annotations(role.Annotations)
+		if ok, err := roleAnnos.Pick(etag); err != nil || !ok {
+			t.Fatalf("expected an ETag on %s, err: %v", resourceKey(role.Id), err)
+		}
+		return etag.GetValue()
+	}
+
+	// Role members are returned with their users page by page, so roles carry an ETag but never match it:
+	// a match would save no requests and only have the syncer write the grants twice.
+	role := roleResourceFor("r-std")
+	if keys, matched := grants(roleResourceType, role); matched || len(keys) != 2 {
+		t.Fatalf("expected role members without a previous ETag, got %v, matched: %v", keys, matched)
+	}
+	previous := roleETag(role)
+	if keys, matched := grants(roleResourceType, role); matched || len(keys) != 2 {
+		t.Errorf("expected unchanged role members to be returned without a match, got %v, matched: %v", keys, matched)
+	}
+	if roleETag(role) != previous {
+		t.Errorf("expected unchanged role members to keep their ETag")
+	}
+	f.user("u-ci").Roles = append(f.user("u-ci").Roles, "r-std")
+	if keys, matched := grants(roleResourceType, role); matched || len(keys) != 3 {
+		t.Errorf("expected changed role members to be returned, got %v, matched: %v", keys, matched)
+	}
+	if roleETag(role) == previous {
+		t.Errorf("expected changed role members to change the ETag")
+	}
+
+	team := teamResourceFor("t-platform")
+	if _, matched := grants(teamResourceType, team); matched {
+		t.Fatal("expected team members not to match without a previous ETag")
+	}
+	lookups := f.requestCount("GET /api/v2/users/u-bob")
+	keys, matched := grants(teamResourceType, team)
+	if f.requestCount("GET /api/v2/users/u-bob") != lookups {
+		t.Errorf("expected unchanged team members not to be looked up")
+	}
+	if !matched {
+		t.Errorf("expected unchanged team members to match the previous ETag")
+	}
+	for _, key := range keys {
+		if strings.HasPrefix(key, "team:t-platform:member ") {
+			t.Errorf("expected member grants to be reused from the previous sync, got %s", key)
+		}
+	}
+	if !containsString(keys, "team:t-platform:admin -> user:u-alice") {
+		t.Errorf("expected admin grants to be returned on a match, got %v", keys)
+	}
+}
+
+func TestSyncWithoutMappingAccess(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	f.mappingsStatus = http.StatusForbidden
+
+	result := fullSync(t, ctx, newTestConnector(t, f, false, false))
+
+	sreGrant := result.grants["team:t-sre:member -> user:u-carol"]
+	if sreGrant == nil {
+		t.Fatal("missing SRE membership grant")
+	}
+	if md := grantMetadata(t, sreGrant.Annotations); md != nil {
+		t.Errorf("expected no IdP metadata without access to SAML mappings, got %v", md)
+	}
+}
+
+func TestRoleGrantRevoke(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	roles := provisionerFor(t, ctx, newTestConnector(t, f, false, false), roleResourceType)
+
+	role := roleResourceFor("r-admin")
+	entitlement := ent.NewAssignmentEntitlement(role, roleMembership)
+
+	annos, err := roles.Grant(ctx, userPrincipal("u-bob"), entitlement)
+	if err != nil {
+		t.Fatalf("granting role: %v", err)
+	}
+	if md := grantMetadata(t, annos); md != nil {
+		t.Errorf("expected no annotations on a fresh grant, got %v", md)
+	}
+	if !containsString(f.user("u-bob").Roles, "r-admin") {
+		t.Fatal("expected user to be added to the role")
+	}
+
+	annos, err = roles.Grant(ctx, userPrincipal("u-bob"), entitlement)
+	if err != nil {
+		t.Fatalf("granting role again: %v", err)
+	}
+	if md := grantMetadata(t, annos); md["no_op"] != true {
+		t.Errorf("expected repeated grant to be a no-op, got %v", md)
+	}
+
+	g := grantFor(entitlement, userPrincipal("u-bob"))
+	if _, err = roles.Revoke(ctx, g); err != nil {
+		t.Fatalf("revoking role: %v", err)
+	}
+	if containsString(f.user("u-bob").Roles, "r-admin") {
+		t.Fatal("expected user to be removed from the role")
+	}
+
+	annos, err = roles.Revoke(ctx, g)
+	if err != nil {
+		t.Fatalf("revoking role again: %v", err)
+	}
+	if md := grantMetadata(t, annos); md["no_op"] != true {
+		t.Errorf("expected repeated revoke to be a no-op, got %v", md)
+	}
+
+	expectedWrites := []string{
+		"POST /api/v2/roles/r-admin/users",
+		"DELETE /api/v2/roles/r-admin/users",
+	}
+	if writes := f.writes(); !reflect.DeepEqual(writes, expectedWrites) {
+		t.Errorf("unexpected writes\n got: %v\nwant: %v", writes, expectedWrites)
+	}
+
+	_, err = roles.Grant(ctx, userPrincipal("u-missing"), entitlement)
+	assertCode(t, err, codes.NotFound)
+	if !strings.Contains(err.Error(), "User not found") {
+		t.Errorf("expected the error to carry the Datadog error body, got %v", err)
+	}
+}
+
+func TestTeamGrantRevoke(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	teams := provisionerFor(t, ctx, newTestConnector(t, f, false, false), teamResourceType)
+
+	team := teamResourceFor("t-platform")
+	member := ent.NewAssignmentEntitlement(team, memberRole)
+	admin := ent.NewPermissionEntitlement(team, adminRole)
+
+	if _, err := teams.Grant(ctx, userPrincipal("u-carol"), member); err != nil {
+		t.Fatalf("granting team membership: %v", err)
+	}
+	if m := f.team("t-platform").membership("u-carol"); m == nil || m.Admin {
+		t.Fatalf("expected user to be added as a regular member, got %+v", m)
+	}
+
+	if _, err := teams.Grant(ctx, userPrincipal("u-carol"), admin); err != nil {
+		t.Fatalf("granting team admin: %v", err)
+	}
+	if m := f.team("t-platform").membership("u-carol"); m == nil || !m.Admin {
+		t.Fatalf("expected member to be promoted to admin, got %+v", m)
+	}
+
+	annos, err := teams.Grant(ctx, userPrincipal("u-carol"), admin)
+	if err != nil {
+		t.Fatalf("granting team admin again: %v", err)
+	}
+	if md := grantMetadata(t, annos); md["no_op"] != true {
+		t.Errorf("expected repeated grant to be a no-op, got %v", md)
+	}
+
+	if _, err = teams.Revoke(ctx, grantFor(admin, userPrincipal("u-carol"))); err != nil {
+		t.Fatalf("revoking team admin: %v", err)
+	}
+	if m := f.team("t-platform").membership("u-carol"); m == nil || m.Admin {
+		t.Fatalf("expected admin to be demoted to a regular member, got %+v", m)
+	}
+
+	if _, err = teams.Revoke(ctx, grantFor(member, userPrincipal("u-carol"))); err != nil {
+		t.Fatalf("revoking team membership: %v", err)
+	}
+	if m := f.team("t-platform").membership("u-carol"); m != nil {
+		t.Fatalf("expected user to be removed from the team, got %+v", m)
+	}
+
+	expectedWrites := []string{
+		"POST /api/v2/team/t-platform/memberships",
+		"PATCH /api/v2/team/t-platform/memberships/u-carol",
+		"PATCH /api/v2/team/t-platform/memberships/u-carol",
+		"DELETE /api/v2/team/t-platform/memberships/u-carol",
+	}
+	if writes := f.writes(); !reflect.DeepEqual(writes, expectedWrites) {
+		t.Errorf("unexpected writes\n got: %v\nwant: %v", writes, expectedWrites)
+	}
+}
+
+func TestTeamGrantIdPManaged(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	teams := provisionerFor(t, ctx, newTestConnector(t, f, false, false), teamResourceType)
+
+	_, err := teams.Grant(ctx, userPrincipal("u-bob"), ent.NewAssignmentEntitlement(teamResourceFor("t-sre"), memberRole))
+	assertCode(t, err, codes.FailedPrecondition)
+
+	if writes := f.writes(); len(writes) != 0 {
+		t.Errorf("expected no writes to a SAML managed team, got %v", writes)
+	}
+}
+
+func TestTeamPermissionSettingGrantRevoke(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	teams := provisionerFor(t, ctx, newTestConnector(t, f, false, false), teamResourceType)
+
+	setting := ent.NewPermissionEntitlement(teamResourceFor("t-data"), teamPermissionSlug("manage_membership", "organization"))
+
+	// A setting holds a single value for the whole team, a role cannot be granted it alone.
+	_, err := teams.Grant(ctx, roleResourceFor("r-std"), setting)
+	assertCode(t, err, codes.InvalidArgument)
+
+	if _, err := teams.Grant(ctx, teamResourceFor("t-data"), setting); err != nil {
+		t.Fatalf("granting team permission setting: %v", err)
+	}
+	if value := f.team("t-data").Permissions["manage_membership"]; value != "organization" {
+		t.Fatalf("expected permission setting to be organization, got %q", value)
+	}
+
+	_, err = teams.Revoke(ctx, grantFor(setting, roleResourceFor("r-std")))
+	assertCode(t, err, codes.InvalidArgument)
+
+	if _, err := teams.Revoke(ctx, grantFor(setting, teamResourceFor("t-data"))); err != nil {
+		t.Fatalf("revoking team permission setting: %v", err)
+	}
+	if value := f.team("t-data").Permissions["manage_membership"]; value != string(defaultTeamPermissionValue) {
+		t.Fatalf("expected permission setting to be reset to %s, got %q", defaultTeamPermissionValue, value)
+	}
+
+	_, err = teams.Grant(ctx, userPrincipal("u-bob"), setting)
+	assertCode(t, err, codes.InvalidArgument)
+}
+
+func TestLogsArchiveGrantRevoke(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	archives := provisionerFor(t, ctx, newTestConnector(t, f, false, false), logsArchiveResourceType)
+
+	archive := &v2.Resource{Id: &v2.ResourceId{ResourceType: logsArchiveResourceType.Id, Resource: "a-audit"}, DisplayName: "Audit"}
+	reader := ent.NewPermissionEntitlement(archive, archiveReader)
+
+	if _, err := archives.Grant(ctx, roleResourceFor("r-std"), reader); err != nil {
+		t.Fatalf("granting archive read access: %v", err)
+	}
+	if !containsString(f.archive("a-audit").ReadRoles, "r-std") {
+		t.Fatal("expected role to be added to the archive readers")
+	}
+
+	annos, err := archives.Grant(ctx, roleResourceFor("r-std"), reader)
+	if err != nil {
+		t.Fatalf("granting archive read access again: %v", err)
+	}
+	if md := grantMetadata(t, annos); md["no_op"] != true {
+		t.Errorf("expected repeated grant to be a no-op, got %v", md)
+	}
+
+	if _, err := archives.Revoke(ctx, grantFor(reader, roleResourceFor("r-admin"))); err != nil {
+		t.Fatalf("revoking archive read access: %v", err)
+	}
+	if containsString(f.archive("a-audit").ReadRoles, "r-admin") {
+		t.Fatal("expected role to be removed from the archive readers")
+	}
+
+	annos, err = archives.Revoke(ctx, grantFor(reader, roleResourceFor("r-admin")))
+	if err != nil {
+		t.Fatalf("revoking archive read access again: %v", err)
+	}
+	if md := grantMetadata(t, annos); md["no_op"] != true {
+		t.Errorf("expected repeated revoke to be a no-op, got %v", md)
+	}
+
+	_, err = archives.Grant(ctx, userPrincipal("u-bob"), reader)
+	assertCode(t, err, codes.InvalidArgument)
+}
+
+func TestIPAllowlistGrantRevoke(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	allowlist := provisionerFor(t, ctx, newTestConnector(t, f, false, false), ipAllowlistResourceType)
+
+	resource := &v2.Resource{Id: &v2.ResourceId{ResourceType: ipAllowlistResourceType.Id, Resource: ipAllowlistID}, DisplayName: "IP allowlist"}
+	entry := ent.NewAssignmentEntitlement(resource, ipAllowlistEntry)
+	office := &v2.Resource{Id: ipAllowlistEntryResourceID("192.0.2.0/24"), Description: "Branch office"}
+
+	if _, err := allowlist.Grant(ctx, office, entry); err != nil {
+		t.Fatalf("adding IP allowlist entry: %v", err)
+	}
+	if len(f.ipAllowlist) != 3 || f.ipAllowlist[2] != (fakeIPAllowlistEntry{CIDR: "192.0.2.0/24", Note: "Branch office"}) {
+		t.Fatalf("expected the entry to be added with its note, got %v", f.ipAllowlist)
+	}
+	if !f.ipAllowlistEnabled {
+		t.Error("expected adding an entry to keep the allowlist enforced")
+	}
+
+	annos, err := allowlist.Grant(ctx, office, entry)
+	if err != nil {
+		t.Fatalf("adding IP allowlist entry again: %v", err)
+	}
+	if md := grantMetadata(t, annos); md["no_op"] != true {
+		t.Errorf("expected repeated grant to be a no-op, got %v", md)
+	}
+
+	// Entries are compared by network, an address is the same entry as its /32 block.
+	annos, err = allowlist.Grant(ctx, &v2.Resource{Id: ipAllowlistEntryResourceID("203.0.113.7/32")}, entry)
+	if err != nil {
+		t.Fatalf("adding IP allowlist entry of an existing address: %v", err)
+	}
+	if md := grantMetadata(t, annos); md["no_op"] != true {
+		t.Errorf("expected granting the block of an existing address to be a no-op, got %v", md)
+	}
+
+	for _, cidr := range []string{"192.0.2.0/24", "10.0.0.1/8"} {
+		if _, err := allowlist.Revoke(ctx, grantFor(entry, &v2.Resource{Id: ipAllowlistEntryResourceID(cidr)})); err != nil {
+			t.Fatalf("removing IP allowlist entry %s: %v", cidr, err)
+		}
+	}
+	if len(f.ipAllowlist) != 1 || f.ipAllowlist[0].CIDR != "203.0.113.7" {
+		t.Fatalf("expected the entries to be removed, got %v", f.ipAllowlist)
+	}
+
+	_, err = allowlist.Revoke(ctx, grantFor(entry, &v2.Resource{Id: ipAllowlistEntryResourceID("203.0.113.7/32")}))
+	assertCode(t, err, codes.FailedPrecondition)
+
+	// Keys without org_management are accepted on startup, changing the allowlist fails on its own.
+	f.failNext(http.MethodPatch, "/api/v2/ip_allowlist", http.StatusForbidden, "Forbidden")
+	_, err = allowlist.Grant(ctx, office, entry)
+	assertCode(t, err, codes.PermissionDenied)
+
+	_, err = allowlist.Grant(ctx, &v2.Resource{Id: ipAllowlistEntryResourceID("not-a-network")}, entry)
+	assertCode(t, err, codes.InvalidArgument)
+	_, err = allowlist.Grant(ctx, userPrincipal("u-bob"), entry)
+	assertCode(t, err, codes.InvalidArgument)
+}
+
+func TestIPAllowlistDuplicateEntries(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	f.ipAllowlist = append(f.ipAllowlist, fakeIPAllowlistEntry{CIDR: "10.0.0.1/8", Note: "Office VPN, again"})
+	d := newTestConnector(t, f, false, false)
+
+	resource := &v2.Resource{Id: &v2.ResourceId{ResourceType: ipAllowlistResourceType.Id, Resource: ipAllowlistID}, DisplayName: "IP allowlist"}
+	grants, _, _, err := newIPAllowlistBuilder(d.client, false, false).Grants(ctx, resource, &pagination.Token{})
+	if err != nil {
+		t.Fatalf("listing IP allowlist grants: %v", err)
+	}
+
+	var principals []string
+	for _, g := range grants {
+		principals = append(principals, g.Principal.Id.Resource)
+	}
+	expected := []string{"10.0.0.0/8", "203.0.113.7/32"}
+	if !reflect.DeepEqual(principals, expected) {
+		t.Errorf("expected entries of the same network to be granted once\n got: %v\nwant: %v", principals, expected)
+	}
+}
+
+func TestConfiguredIPAllowlistEntries(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+
+	_, err := New(ctx, Config{Site: "datadoghq.com", BaseURL: f.URL(), APIKey: fakeAPIKey, AppKey: fakeAppKey, IPAllowlistEntries: []string{"not-a-network"}})
+	if err == nil {
+		t.Fatal("expected an invalid IP allowlist entry to be rejected")
+	}
+
+	d, err := New(ctx, Config{Site: "datadoghq.com", BaseURL: f.URL(), APIKey: fakeAPIKey, AppKey: fakeAppKey, IPAllowlistEntries: []string{"192.0.2.1/24=Branch office", "10.0.0.5/8"}})
+	if err != nil {
+		t.Fatalf("creating connector: %v", err)
+	}
+	d.client.limiter.interval = 0
+
+	builder := newIPAllowlistEntryBuilder(d.client, d.ipAllowlistEntries)
+	resources, _, _, err := builder.List(ctx, &v2.ResourceId{ResourceType: ipAllowlistResourceType.Id, Resource: ipAllowlistID}, &pagination.Token{})
+	if err != nil {
+		t.Fatalf("listing IP allowlist entries: %v", err)
+	}
+
+	var ids []string
+	for _, resource := range resources {
+		ids = append(ids, resource.Id.Resource)
+	}
+	expected := []string{"10.0.0.0/8", "203.0.113.7/32", "192.0.2.0/24"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expected the configured entries missing from the allowlist to be listed once\n got: %v\nwant: %v", ids, expected)
+	}
+
+	branch := appProfile(t, resources[2])
+	if branch["in_allowlist"] != false || branch["note"] != "Branch office" {
+		t.Errorf("expected the configured entry to carry its note and not be in the allowlist, got %v", branch)
+	}
+
+	allowlist := provisionerFor(t, ctx, d, ipAllowlistResourceType)
+	resource := &v2.Resource{Id: &v2.ResourceId{ResourceType: ipAllowlistResourceType.Id, Resource: ipAllowlistID}, DisplayName: "IP allowlist"}
+	if _, err := allowlist.Grant(ctx, resources[2], ent.NewAssignmentEntitlement(resource, ipAllowlistEntry)); err != nil {
+		t.Fatalf("adding configured IP allowlist entry: %v", err)
+	}
+	if len(f.ipAllowlist) != 3 || f.ipAllowlist[2] != (fakeIPAllowlistEntry{CIDR: "192.0.2.0/24", Note: "Branch office"}) {
+		t.Fatalf("expected the configured entry to be added with its note, got %v", f.ipAllowlist)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	d := newTestConnector(t, f, true, false)
+
+	_, err := provisionerFor(t, ctx, d, roleResourceType).Grant(ctx, userPrincipal("u-bob"), ent.NewAssignmentEntitlement(roleResourceFor("r-admin"), roleMembership))
+	assertCode(t, err, codes.FailedPrecondition)
+
+	_, err = provisionerFor(t, ctx, d, teamResourceType).Revoke(ctx, grantFor(ent.NewAssignmentEntitlement(teamResourceFor("t-platform"), memberRole), userPrincipal("u-bob")))
+	assertCode(t, err, codes.FailedPrecondition)
+
+	if requests := len(f.requests); requests != 0 {
+		t.Errorf("expected read-only provisioning to make no requests, got %d", requests)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	teams := provisionerFor(t, ctx, newTestConnector(t, f, false, true), teamResourceType)
+
+	annos, err := teams.Grant(ctx, userPrincipal("u-carol"), ent.NewAssignmentEntitlement(teamResourceFor("t-platform"), memberRole))
+	if err != nil {
+		t.Fatalf("planning team membership: %v", err)
+	}
+
+	md := grantMetadata(t, annos)
+	if md["dry_run"] != true || md["method"] != http.MethodPost {
+		t.Errorf("expected a planned POST, got %v", md)
+	}
+	if writes := f.writes(); len(writes) != 0 {
+		t.Errorf("expected dry-run to make no writes, got %v", writes)
+	}
+	if f.team("t-platform").membership("u-carol") != nil {
+		t.Error("expected dry-run to leave the team unchanged")
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	users := newTestConnector(t, f, false, false).ResourceSyncers(ctx)[0]
+
+	// A rate limited request is retried.
+	f.failNext(http.MethodGet, "/api/v2/users", http.StatusTooManyRequests, "Rate limit exceeded")
+	page, _, _, err := users.List(ctx, nil, &pagination.Token{})
+	if err != nil {
+		t.Fatalf("listing users after the rate limit: %v", err)
+	}
+	if len(page) != fakeDefaultPageSize {
+		t.Errorf("expected a full page of users, got %d", len(page))
+	}
+
+	// Once the retries run out the error is surfaced with the Datadog error body and the request ID.
+	for i := 0; i <= maxRetries; i++ {
+		f.failNext(http.MethodGet, "/api/v2/users", http.StatusTooManyRequests, "Rate limit exceeded")
+	}
+	_, _, _, err = users.List(ctx, nil, &pagination.Token{})
+	assertCode(t, err, codes.ResourceExhausted)
+	if !strings.Contains(err.Error(), "Rate limit exceeded") || !strings.Contains(err.Error(), "(request ") {
+		t.Errorf("expected the error to carry the Datadog error body and request ID, got %v", err)
+	}
+}
+
+func TestNamedIntegrationAccounts(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	f.integrations = map[string][]*fakeCloudAccount{
+		"/api/v2/integrations/confluent-cloud/accounts": {{ID: "cc-1", Name: "CONFLUENTKEY1234"}},
+	}
+	f.namedIntegrations = map[string]interface{}{
+		"/api/v1/integration/pagerduty/configuration/services/oncall-primary": map[string]interface{}{"service_name": "oncall-primary"},
+		"/api/v1/integration/slack/configuration/accounts/acme/channels": []interface{}{
+			map[string]interface{}{"name": "#alerts"},
+			map[string]interface{}{"name": "#ops"},
+		},
+		"/api/v1/integration/webhooks/configuration/webhooks/deploys": map[string]interface{}{
+			"name":      "deploys",
+			"url":       "https://hooks.example.com/services/secret-token",
+			"encode_as": "json",
+		},
+	}
+
+	d, err := New(ctx, Config{
+		Site:              "datadoghq.com",
+		BaseURL:           f.URL(),
+		APIKey:            fakeAPIKey,
+		AppKey:            fakeAppKey,
+		PagerDutyServices: []string{"oncall-primary", "gone"},
+		SlackAccounts:     []string{"acme"},
+		Webhooks:          []string{"deploys"},
+	})
+	if err != nil {
+		t.Fatalf("creating connector: %v", err)
+	}
+	d.client.limiter.interval = 0
+	builder := newIntegrationAccountBuilder(d.client, d.integrationSources)
+
+	resources := map[string]*v2.Resource{}
+	token := &pagination.Token{}
+	for {
+		page, next, _, err := builder.List(ctx, nil, token)
+		if err != nil {
+			t.Fatalf("listing integration accounts: %v", err)
+		}
+		for _, resource := range page {
+			resources[resource.Id.Resource] = resource
+		}
+		if next == "" {
+			break
+		}
+		token = &pagination.Token{Token: next}
+	}
+
+	var ids []string
+	for id := range resources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	expected := []string{"Confluent:cc-1", "PagerDuty:oncall-primary", "Slack:acme", "Webhooks:deploys"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expected the configured integrations to be synced and the missing service to be skipped\n got: %v\nwant: %v", ids, expected)
+	}
+
+	confluent := resources["Confluent:cc-1"]
+	if confluent.DisplayName != "****1234" {
+		t.Errorf("expected the Confluent account to be named after the end of its API key, got %q", confluent.DisplayName)
+	}
+	for _, resource := range resources {
+		profile := appProfile(t, resource)
+		for key, value := range profile {
+			if s, ok := value.(string); ok && (strings.Contains(s, "CONFLUENTKEY") || strings.Contains(s, "secret-token")) {
+				t.Errorf("expected %s to carry no credentials, %s is %q", resource.Id.Resource, key, s)
+			}
+		}
+	}
+
+	if channels := appProfile(t, resources["Slack:acme"])["channels"]; !reflect.DeepEqual(channels, []interface{}{"#alerts", "#ops"}) {
+		t.Errorf("expected the Slack account to carry its channels, got %v", channels)
+	}
+	if host := appProfile(t, resources["Webhooks:deploys"])["host"]; host != "hooks.example.com" {
+		t.Errorf("expected the webhook to carry the host of its URL, got %v", host)
+	}
+}
+
+// appProfile returns the profile of the app trait of the resource.
+func appProfile(t *testing.T, resource *v2.Resource) map[string]interface{} {
+	t.Helper()
+
+	trait, err := rs.GetAppTrait(resource)
+	if err != nil {
+		t.Fatalf("getting the app trait of %s: %v", resource.Id.Resource, err)
+	}
+
+	return trait.Profile.AsMap()
+}
+
+func TestIntegrationAccountsSkipForbidden(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDatadog(t)
+	seedFakeDatadog(f)
+	f.integrations["/api/v2/integrations/fastly/accounts"] = []*fakeCloudAccount{{ID: "fa-1", Name: "edge"}}
+	f.failNext(http.MethodGet, "/api/v2/integrations/cloudflare/accounts", http.StatusForbidden, "Forbidden")
+
+	c := newTestConnector(t, f, false, false)
+	builder := newIntegrationAccountBuilder(c.client, c.integrationSources)
+
+	var ids []string
+	token := &pagination.Token{}
+	for {
+		resources, next, _, err := builder.List(ctx, nil, token)
+		if err != nil {
+			t.Fatalf("listing integration accounts: %v", err)
+		}
+		for _, resource := range resources {
+			ids = append(ids, resource.Id.Resource)
+		}
+		if next == "" {
+			break
+		}
+		token = &pagination.Token{Token: next}
+	}
+
+	expected := []string{"Fastly:fa-1", "Opsgenie:og-1"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected the forbidden Cloudflare integration to be skipped\n got: %v\nwant: %v", ids, expected)
+	}
+}
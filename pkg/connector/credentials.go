@@ -0,0 +1,158 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// credentials holds the Datadog API and application keys. Keys given as files are re-read whenever
+// the file changes, so a secret manager can rotate them while the connector is running.
+type credentials struct {
+	mu     sync.Mutex
+	apiKey *keySource
+	appKey *keySource
+}
+
+// keySource is a key given either directly or as the path of a file containing it.
+type keySource struct {
+	name    string
+	value   string
+	path    string
+	modTime time.Time
+}
+
+func newCredentials(apiKey, appKey, apiKeyFile, appKeyFile string) (*credentials, error) {
+	c := &credentials{
+		apiKey: &keySource{name: "API key", value: apiKey, path: apiKeyFile},
+		appKey: &keySource{name: "application key", value: appKey, path: appKeyFile},
+	}
+
+	for _, source := range []*keySource{c.apiKey, c.appKey} {
+		if source.path == "" {
+			continue
+		}
+
+		_, err := source.load(false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Keys returns the current API and application keys, re-reading key files that changed since they were last read.
+// If a changed file cannot be read, the previous key is kept and a warning is logged.
+func (c *credentials) Keys(ctx context.Context) (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.refresh(ctx, false)
+
+	return c.apiKey.value, c.appKey.value
+}
+
+// Reload re-reads the key files even if they do not look changed, and reports whether any key changed.
+func (c *credentials) Reload(ctx context.Context) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.refresh(ctx, true)
+}
+
+func (c *credentials) refresh(ctx context.Context, force bool) bool {
+	l := ctxzap.Extract(ctx)
+
+	changed := false
+	for _, source := range []*keySource{c.apiKey, c.appKey} {
+		if source.path == "" {
+			continue
+		}
+
+		sourceChanged, err := source.load(force)
+		if err != nil {
+			l.Warn("baton-datadog: failed to reload key file, keeping the previous key", zap.String("key", source.name), zap.Error(err))
+			continue
+		}
+		if sourceChanged {
+			l.Info("baton-datadog: reloaded rotated key", zap.String("key", source.name), zap.String("path", source.path))
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// load reads the key file if its modification time changed or force is set, and reports whether the key changed.
+func (s *keySource) load(force bool) (bool, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, fmt.Errorf("baton-datadog: failed to read %s file: %w", s.name, err)
+	}
+	if !force && info.ModTime().Equal(s.modTime) {
+		return false, nil
+	}
+
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return false, fmt.Errorf("baton-datadog: failed to read %s file: %w", s.name, err)
+	}
+
+	value := strings.TrimSpace(string(content))
+	if value == "" {
+		return false, fmt.Errorf("baton-datadog: %s file %s is empty", s.name, s.path)
+	}
+
+	changed := value != s.value
+	s.value = value
+	s.modTime = info.ModTime()
+
+	return changed, nil
+}
+
+// rotatingTransport retries requests Datadog rejected with a 403 once the keys were reloaded,
+// since a rotated key may have been revoked before the file change was noticed.
+type rotatingTransport struct {
+	base        http.RoundTripper
+	credentials *credentials
+}
+
+func (t *rotatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		return resp, err
+	}
+
+	// The body has already been consumed and cannot be sent again.
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	ctx := req.Context()
+	if !t.credentials.Reload(ctx) {
+		return resp, nil
+	}
+
+	retry := req.Clone(ctx)
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+	}
+
+	apiKey, appKey := t.credentials.Keys(ctx)
+	retry.Header.Set("DD-API-KEY", apiKey)
+	retry.Header.Set("DD-APPLICATION-KEY", appKey)
+
+	resp.Body.Close()
+	return t.base.RoundTrip(retry)
+}
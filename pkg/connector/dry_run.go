@@ -0,0 +1,254 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// plannedChange describes a Datadog API call a provisioning action would make in dry-run mode.
+type plannedChange struct {
+	Method string
+	Path   string
+	// CurrentState describes what the connector found in Datadog before planning the call.
+	CurrentState string
+	// Effect describes what the call is expected to change. It is empty when no call would be made.
+	Effect string
+}
+
+// Annotations returns the planned change as grant metadata, the response of a dry-run Grant or Revoke.
+func (p *plannedChange) Annotations() (annotations.Annotations, error) {
+	metadata := map[string]interface{}{
+		"dry_run":       true,
+		"current_state": p.CurrentState,
+	}
+	if p.Effect != "" {
+		metadata["method"] = p.Method
+		metadata["path"] = p.Path
+		metadata["expected_effect"] = p.Effect
+	} else {
+		metadata["expected_effect"] = "none, the desired state already holds"
+	}
+
+	md, err := structpb.NewStruct(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return annotations.New(&v2.GrantMetadata{Metadata: md}), nil
+}
+
+// planRoleMembership resolves the user and role of a role membership change and reports the call
+// Grant (add is true) or Revoke would make, without changing anything in Datadog.
+func (r *roleBuilder) planRoleMembership(ctx context.Context, userID, roleID string, add bool) (annotations.Annotations, error) {
+	rolesApi := datadogV2.NewRolesApi(r.client.api)
+	role, resp, err := rolesApi.GetRole(ctx, roleID)
+	if err != nil {
+		return nil, wrapError(err, resp, fmt.Sprintf("baton-datadog: failed to resolve role %s", roleID))
+	}
+
+	usersApi := datadogV2.NewUsersApi(r.client.api)
+	user, resp, err := usersApi.GetUser(ctx, userID)
+	if err != nil {
+		return nil, wrapError(err, resp, fmt.Sprintf("baton-datadog: failed to resolve user %s", userID))
+	}
+	userData := user.GetData()
+	roleName := role.Data.Attributes.GetName()
+	userEmail := userData.Attributes.GetEmail()
+
+	change := &plannedChange{
+		Path: fmt.Sprintf("/api/v2/roles/%s/users", roleID),
+	}
+	isMember := userHasRole(&userData, roleID)
+	if isMember {
+		change.CurrentState = fmt.Sprintf("user %s is a member of role %s", userEmail, roleName)
+	} else {
+		change.CurrentState = fmt.Sprintf("user %s is not a member of role %s", userEmail, roleName)
+	}
+
+	switch {
+	case add && !isMember:
+		change.Method = http.MethodPost
+		change.Effect = fmt.Sprintf("user %s will be added to role %s", userEmail, roleName)
+	case !add && isMember:
+		change.Method = http.MethodDelete
+		change.Effect = fmt.Sprintf("user %s will be removed from role %s", userEmail, roleName)
+	}
+
+	return change.Annotations()
+}
+
+// planTeamMembership resolves the user and team of a team membership change and reports the call
+// Grant (add is true) or Revoke would make, without changing anything in Datadog.
+func (t *teamBuilder) planTeamMembership(ctx context.Context, userID, teamID, slug string, add bool) (annotations.Annotations, error) {
+	teamsApi := datadogV2.NewTeamsApi(t.client.api)
+	team, resp, err := teamsApi.GetTeam(ctx, teamID)
+	if err != nil {
+		return nil, wrapError(err, resp, fmt.Sprintf("baton-datadog: failed to resolve team %s", teamID))
+	}
+
+	usersApi := datadogV2.NewUsersApi(t.client.api)
+	user, resp, err := usersApi.GetUser(ctx, userID)
+	if err != nil {
+		return nil, wrapError(err, resp, fmt.Sprintf("baton-datadog: failed to resolve user %s", userID))
+	}
+	userData := user.GetData()
+	teamName := team.Data.Attributes.GetName()
+	userEmail := userData.Attributes.GetEmail()
+
+	membership, err := findTeamMembership(ctx, teamsApi, teamID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &plannedChange{}
+	switch {
+	case membership == nil:
+		change.CurrentState = fmt.Sprintf("user %s is not a member of team %s", userEmail, teamName)
+	case isTeamAdmin(membership):
+		change.CurrentState = fmt.Sprintf("user %s is an admin of team %s", userEmail, teamName)
+	default:
+		change.CurrentState = fmt.Sprintf("user %s is a member of team %s", userEmail, teamName)
+	}
+
+	holds := membership != nil
+	if slug == adminRole {
+		holds = isTeamAdmin(membership)
+	}
+
+	switch {
+	case add && !holds && membership != nil:
+		change.Method = http.MethodPatch
+		change.Path = fmt.Sprintf("/api/v2/team/%s/memberships/%s", teamID, userID)
+		change.Effect = fmt.Sprintf("user %s will be promoted to admin of team %s", userEmail, teamName)
+	case add && !holds:
+		change.Method = http.MethodPost
+		change.Path = fmt.Sprintf("/api/v2/team/%s/memberships", teamID)
+		change.Effect = fmt.Sprintf("user %s will be added to team %s as %s", userEmail, teamName, slug)
+	case !add && holds && slug == adminRole:
+		change.Method = http.MethodPatch
+		change.Path = fmt.Sprintf("/api/v2/team/%s/memberships/%s", teamID, userID)
+		change.Effect = fmt.Sprintf("user %s will be demoted to a regular member of team %s", userEmail, teamName)
+	case !add && holds:
+		change.Method = http.MethodDelete
+		change.Path = fmt.Sprintf("/api/v2/team/%s/memberships/%s", teamID, userID)
+		change.Effect = fmt.Sprintf("user %s will be removed from team %s", userEmail, teamName)
+	}
+
+	return change.Annotations()
+}
+
+// planPermissionSetting reads the current value of a team permission setting and reports the call
+// Grant (add is true) or Revoke of the entitlement for value would make, without changing anything in Datadog.
+func (t *teamBuilder) planPermissionSetting(
+	ctx context.Context,
+	teamID string,
+	action datadogV2.TeamPermissionSettingSerializerAction,
+	value datadogV2.TeamPermissionSettingValue,
+	add bool,
+) (annotations.Annotations, error) {
+	teamsApi := datadogV2.NewTeamsApi(t.client.api)
+	current, err := getTeamPermissionSetting(ctx, teamsApi, teamID, action)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &plannedChange{
+		Method:       http.MethodPut,
+		Path:         fmt.Sprintf("/api/v2/team/%s/permission-settings/%s", teamID, action),
+		CurrentState: fmt.Sprintf("permission setting %s of team %s is set to %s", action, teamID, current),
+	}
+	switch {
+	case add && current != value:
+		change.Effect = fmt.Sprintf("permission setting %s of team %s will be set to %s", action, teamID, value)
+	case !add && current == value:
+		change.Effect = fmt.Sprintf("permission setting %s of team %s will be reset to %s", action, teamID, defaultTeamPermissionValue)
+	}
+
+	return change.Annotations()
+}
+
+// planArchiveReader resolves the read roles of a logs archive and reports the call Grant (add is true)
+// or Revoke of read access for the role would make, without changing anything in Datadog.
+func (a *logsArchiveBuilder) planArchiveReader(ctx context.Context, archiveID, roleID string, add bool) (annotations.Annotations, error) {
+	api := datadogV2.NewLogsArchivesApi(a.client.api)
+	archive, resp, err := api.GetLogsArchive(ctx, archiveID)
+	if err != nil {
+		return nil, wrapError(err, resp, fmt.Sprintf("baton-datadog: failed to resolve logs archive %s", archiveID))
+	}
+
+	rolesApi := datadogV2.NewRolesApi(a.client.api)
+	role, resp, err := rolesApi.GetRole(ctx, roleID)
+	if err != nil {
+		return nil, wrapError(err, resp, fmt.Sprintf("baton-datadog: failed to resolve role %s", roleID))
+	}
+
+	isReader, err := archiveHasReadRole(ctx, api, archiveID, roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	archiveData := archive.GetData()
+	archiveAttributes := archiveData.GetAttributes()
+	archiveName := archiveAttributes.GetName()
+	roleName := role.Data.Attributes.GetName()
+
+	change := &plannedChange{
+		Path: fmt.Sprintf("/api/v2/logs/config/archives/%s/readers", archiveID),
+	}
+	if isReader {
+		change.CurrentState = fmt.Sprintf("role %s can read logs archive %s", roleName, archiveName)
+	} else {
+		change.CurrentState = fmt.Sprintf("role %s cannot read logs archive %s", roleName, archiveName)
+	}
+
+	switch {
+	case add && !isReader:
+		change.Method = http.MethodPost
+		change.Effect = fmt.Sprintf("role %s will be allowed to read logs archive %s", roleName, archiveName)
+	case !add && isReader:
+		change.Method = http.MethodDelete
+		change.Effect = fmt.Sprintf("role %s will no longer be allowed to read logs archive %s", roleName, archiveName)
+	}
+
+	return change.Annotations()
+}
+
+// planIPAllowlistEntry resolves the IP allowlist and reports the call Grant (add is true) or Revoke
+// of the CIDR block would make, without changing anything in Datadog.
+func (i *ipAllowlistBuilder) planIPAllowlistEntry(ctx context.Context, cidr string, add bool) (annotations.Annotations, error) {
+	attributes, err := i.currentIPAllowlist(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining, present := ipAllowlistWithout(attributes, cidr)
+	if !add && present && attributes.GetEnabled() && len(remaining) == 0 {
+		return nil, errLastIPAllowlistEntry
+	}
+
+	change := &plannedChange{
+		Path: "/api/v2/ip_allowlist",
+	}
+	if present {
+		change.CurrentState = fmt.Sprintf("%s is in the IP allowlist", cidr)
+	} else {
+		change.CurrentState = fmt.Sprintf("%s is not in the IP allowlist", cidr)
+	}
+
+	switch {
+	case add && !present:
+		change.Method = http.MethodPatch
+		change.Effect = fmt.Sprintf("%s will be added to the IP allowlist", cidr)
+	case !add && present:
+		change.Method = http.MethodPatch
+		change.Effect = fmt.Sprintf("%s will be removed from the IP allowlist", cidr)
+	}
+
+	return change.Annotations()
+}
@@ -0,0 +1,119 @@
+package connector
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// APIError is a failed call to the Datadog API. It carries the HTTP status and the error body returned by Datadog,
+// and maps to a gRPC status code so the SDK and its callers can tell auth failures, missing resources,
+// conflicts, rate limiting and server errors apart.
+type APIError struct {
+	// Operation describes what the connector was doing, e.g. "error listing teams".
+	Operation  string
+	StatusCode int
+	Body       string
+	// RequestID identifies the failed request in the connector logs.
+	RequestID string
+	Err       error
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.Operation, e.Err)
+	if e.Body != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Body)
+	}
+	if e.RequestID != "" {
+		msg = fmt.Sprintf("%s (request %s)", msg, e.RequestID)
+	}
+
+	return msg
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// GRPCStatus returns the gRPC status matching the HTTP status returned by Datadog.
+func (e *APIError) GRPCStatus() *status.Status {
+	return status.New(grpcCode(e.StatusCode), e.Error())
+}
+
+// grpcCode maps an HTTP status returned by Datadog to a gRPC code.
+// A zero status means no response was received at all, e.g. on network errors.
+func grpcCode(statusCode int) codes.Code {
+	switch {
+	case statusCode == 0:
+		return codes.Unavailable
+	case statusCode == http.StatusBadRequest, statusCode == http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case statusCode == http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case statusCode == http.StatusForbidden:
+		return codes.PermissionDenied
+	case statusCode == http.StatusNotFound:
+		return codes.NotFound
+	case statusCode == http.StatusConflict:
+		return codes.AlreadyExists
+	case statusCode == http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case statusCode >= http.StatusInternalServerError:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
+
+// wrapError translates an error returned by the Datadog client into an APIError.
+func wrapError(err error, resp *http.Response, operation string) error {
+	if err == nil {
+		return nil
+	}
+
+	apiErr := &APIError{
+		Operation: operation,
+		Err:       err,
+	}
+	if resp != nil {
+		apiErr.StatusCode = resp.StatusCode
+		if resp.Request != nil {
+			apiErr.RequestID = resp.Request.Header.Get(requestIDHeader)
+		}
+	}
+
+	var openAPIErr datadog.GenericOpenAPIError
+	if errors.As(err, &openAPIErr) {
+		apiErr.Body = string(openAPIErr.Body())
+	}
+
+	return apiErr
+}
+
+// ReadOnlyError is returned by every provisioning action when the connector runs in read-only mode.
+// It is returned before any call is made to Datadog.
+type ReadOnlyError struct {
+	Action string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("baton-datadog: refusing to %s, the connector is running in read-only mode", e.Action)
+}
+
+// GRPCStatus reports read-only rejections as a failed precondition.
+func (e *ReadOnlyError) GRPCStatus() *status.Status {
+	return status.New(codes.FailedPrecondition, e.Error())
+}
+
+// checkWritable returns a ReadOnlyError for the action if the connector is read-only.
+func checkWritable(readOnly bool, action string) error {
+	if readOnly {
+		return &ReadOnlyError{Action: action}
+	}
+
+	return nil
+}
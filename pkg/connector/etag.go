@@ -0,0 +1,116 @@
+package connector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+)
+
+// fingerprint is a hash of values that does not depend on their order, built up page by page.
+// Datadog does not return ETags for the membership APIs, so the fingerprint of the grants stands in for one.
+type fingerprint [sha256.Size]byte
+
+// Add mixes the value into the fingerprint. Values are expected to be distinct, adding one twice cancels it out.
+func (f *fingerprint) Add(value string) {
+	sum := sha256.Sum256([]byte(value))
+	for i := range f {
+		f[i] ^= sum[i]
+	}
+}
+
+func (f *fingerprint) String() string {
+	return hex.EncodeToString(f[:])
+}
+
+// parseFingerprintPageToken returns the page of grants to fetch and the fingerprint of the pages fetched before it.
+func parseFingerprintPageToken(i string, resourceID *v2.ResourceId) (*pagination.Bag, int64, fingerprint, error) {
+	var fp fingerprint
+
+	b := &pagination.Bag{}
+	err := b.Unmarshal(i)
+	if err != nil {
+		return nil, 0, fp, err
+	}
+
+	if b.Current() == nil {
+		b.Push(pagination.PageState{
+			ResourceTypeID: resourceID.ResourceType,
+			ResourceID:     resourceID.Resource,
+		})
+	}
+
+	token := b.PageToken()
+	if token == "" {
+		return b, 0, fp, nil
+	}
+
+	pageToken, fpToken, ok := strings.Cut(token, ":")
+	if !ok {
+		return nil, 0, fp, fmt.Errorf("baton-datadog: invalid page token %q", token)
+	}
+	page, err := getPageFromPageToken(pageToken)
+	if err != nil {
+		return nil, 0, fp, err
+	}
+	decoded, err := hex.DecodeString(fpToken)
+	if err != nil || len(decoded) != len(fp) {
+		return nil, 0, fp, fmt.Errorf("baton-datadog: invalid fingerprint in page token %q", token)
+	}
+	copy(fp[:], decoded)
+
+	return b, page, fp, nil
+}
+
+// getFingerprintPageToken returns the token of the page, carrying the fingerprint of the pages before it.
+func getFingerprintPageToken(bag *pagination.Bag, page int64, fp fingerprint) (string, error) {
+	pageToken, err := bag.NextToken(fmt.Sprintf("%d:%s", page, fp.String()))
+	if err != nil {
+		return "", err
+	}
+
+	return pageToken, nil
+}
+
+// hasETag reports whether the resource carries an ETag of the grants of the entitlement from the previous sync.
+func hasETag(resource *v2.Resource, slug string) bool {
+	previous := &v2.ETag{}
+	resourceAnnos := annotations.Annotations(resource.GetAnnotations())
+	ok, err := resourceAnnos.Pick(previous)
+
+	return err == nil && ok && previous.GetEntitlementId() == ent.NewEntitlementID(resource, slug)
+}
+
+// etagAnnotation returns the ETag of the grants of an entitlement of the resource, without checking it against the
+// previous sync. It is used where a match would save no requests, the syncer then keeps the grants just returned.
+func etagAnnotation(resource *v2.Resource, slug, value string) annotations.Annotations {
+	var rv annotations.Annotations
+	rv.Update(&v2.ETag{Value: value, EntitlementId: ent.NewEntitlementID(resource, slug)})
+
+	return rv
+}
+
+// etagAnnotations returns the ETag of the grants of an entitlement of the resource, along with an ETagMatch
+// if the resource still carries the same ETag from the previous sync. On a match the syncer reuses the grants
+// of the entitlement from the previous sync, so they are not returned again.
+func etagAnnotations(resource *v2.Resource, slug, value string) (annotations.Annotations, bool) {
+	entitlementID := ent.NewEntitlementID(resource, slug)
+
+	previous := &v2.ETag{}
+	resourceAnnos := annotations.Annotations(resource.GetAnnotations())
+	ok, err := resourceAnnos.Pick(previous)
+	matched := err == nil && ok && previous.GetValue() == value && previous.GetEntitlementId() == entitlementID
+
+	var rv annotations.Annotations
+	if matched {
+		rv.Update(&v2.ETagMatch{EntitlementId: entitlementID})
+	}
+	rv.Update(&v2.ETag{Value: value, EntitlementId: entitlementID})
+
+	return rv, matched
+}
@@ -0,0 +1,1418 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	fakeAPIKey = "fake-api-key"
+	fakeAppKey = "fake-app-key-abcd"
+
+	// fakeDefaultPageSize is deliberately small so a handful of fixtures already spans several pages.
+	fakeDefaultPageSize = 2
+)
+
+type fakeUser struct {
+	ID             string
+	Name           string
+	Email          string
+	Status         string
+	ServiceAccount bool
+	Roles          []string
+}
+
+type fakeRole struct {
+	ID          string
+	Name        string
+	Permissions []string
+}
+
+type fakePermission struct {
+	ID   string
+	Name string
+}
+
+type fakeTeamLink struct {
+	ID    string
+	Label string
+	URL   string
+}
+
+type fakeMembership struct {
+	UserID string
+	Admin  bool
+}
+
+type fakeTeam struct {
+	ID          string
+	Name        string
+	Handle      string
+	Description string
+	Links       []fakeTeamLink
+	Memberships []fakeMembership
+	// Permissions maps a permission setting action to its current value.
+	Permissions map[string]string
+}
+
+type fakeMapping struct {
+	ID             string
+	AttributeKey   string
+	AttributeValue string
+	TeamID         string
+}
+
+type fakeArchive struct {
+	ID        string
+	Name      string
+	Query     string
+	Bucket    string
+	ReadRoles []string
+}
+
+type fakeGlobalVariable struct {
+	ID              string
+	Name            string
+	Secure          bool
+	RestrictedRoles []string
+}
+
+type fakePrivateLocation struct {
+	ID              string
+	Name            string
+	RestrictedRoles []string
+}
+
+type fakeSyntheticsTest struct {
+	PublicID        string
+	Name            string
+	Type            string
+	Status          string
+	MonitorID       int64
+	CreatorEmail    string
+	RestrictedRoles []string
+}
+
+type fakeService struct {
+	Name     string
+	Team     string
+	Tier     string
+	Contacts []string
+}
+
+// fakeCloudAccount is an account of one of the cloud or third-party integrations, ID is the AWS account ID,
+// the GCP client email, the Azure client ID or the ID of the third-party account.
+type fakeCloudAccount struct {
+	ID   string
+	Name string
+}
+
+// fakeSecurityRule is a Security Monitoring rule, Creator is the handle of the user who created it.
+type fakeSecurityRule struct {
+	ID        string
+	Name      string
+	Type      string
+	Enabled   bool
+	IsDefault bool
+	Deleted   bool
+	Creator   string
+}
+
+type fakeScannerGroup struct {
+	ID      string
+	Name    string
+	Enabled bool
+	Rules   []string
+}
+
+// fakeIPAllowlistEntry is an entry of the IP allowlist, identified by its CIDR block.
+type fakeIPAllowlistEntry struct {
+	CIDR string
+	Note string
+}
+
+type fakeFailure struct {
+	Status int
+	Body   string
+}
+
+// fakeDatadog is an in-memory stand-in for the parts of the Datadog API used by the connector:
+// users, roles, permissions, teams, team memberships and permission settings, SAML mappings,
+// logs archives and their read roles, Service Catalog services, cloud integration accounts, Security Monitoring rules, Sensitive Data Scanner groups, the IP allowlist, incident teams and services, Synthetics tests, global variables and private locations,
+// application keys and API key validation. It pages list endpoints, checks the API and application keys,
+// and can be told to fail specific requests, e.g. with a 429, to exercise error handling.
+type fakeDatadog struct {
+	server *httptest.Server
+
+	mu sync.Mutex
+	// apiKey and appKey are the keys the fake accepts, they can be changed to simulate a rotation.
+	apiKey      string
+	appKey      string
+	users       []*fakeUser
+	roles       []*fakeRole
+	permissions []fakePermission
+	teams       []*fakeTeam
+	mappings    []fakeMapping
+	archives    []*fakeArchive
+	variables   []*fakeGlobalVariable
+	locations   []*fakePrivateLocation
+	tests       []*fakeSyntheticsTest
+	services    []*fakeService
+	aws         []*fakeCloudAccount
+	gcp         []*fakeCloudAccount
+	azure       []*fakeCloudAccount
+	// integrations holds the third-party integration accounts by the path listing them.
+	integrations map[string][]*fakeCloudAccount
+	// namedIntegrations holds the PagerDuty services, Slack channels and webhooks by the path reading them by name.
+	namedIntegrations map[string]interface{}
+	// securityRules are the Security Monitoring rules, Sensitive Data Scanner groups, deleted ones included.
+	securityRules []*fakeSecurityRule
+	// scannerGroups are the Sensitive Data Scanner groups, each rule is named after its ID.
+	scannerGroups []*fakeScannerGroup
+	// ipAllowlistEnabled and ipAllowlist are the enforcement and the entries of the IP allowlist.
+	ipAllowlistEnabled bool
+	ipAllowlist        []fakeIPAllowlistEntry
+	// incidentTeams and incidentServices are the names of the incident teams and services by ID.
+	incidentTeams    map[string]string
+	incidentServices map[string]string
+	// mappingsStatus makes listing SAML mappings fail with the status, e.g. 403 for keys without access.
+	mappingsStatus int
+	// appKeyScopes are the scopes of the application key, nil for an unscoped key acting with every permission of appKeyOwner.
+	appKeyScopes []string
+	appKeyOwner  string
+	failures     map[string][]fakeFailure
+	requests     []string
+}
+
+func newFakeDatadog(t *testing.T) *fakeDatadog {
+	t.Helper()
+
+	f := &fakeDatadog{
+		apiKey:   fakeAPIKey,
+		appKey:   fakeAppKey,
+		failures: make(map[string][]fakeFailure),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+// URL returns the base URL of the fake API.
+func (f *fakeDatadog) URL() string {
+	return f.server.URL
+}
+
+// failNext makes the next request matching the method and path fail with the status and a Datadog error body.
+func (f *fakeDatadog) failNext(method, path string, status int, message string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := json.Marshal(map[string]interface{}{"errors": []string{message}})
+	key := method + " " + path
+	f.failures[key] = append(f.failures[key], fakeFailure{Status: status, Body: string(body)})
+}
+
+// writes returns the mutating requests received so far, as "METHOD path".
+func (f *fakeDatadog) writes() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var rv []string
+	for _, r := range f.requests {
+		if !strings.HasPrefix(r, http.MethodGet+" ") {
+			rv = append(rv, r)
+		}
+	}
+
+	return rv
+}
+
+// requestCount returns how many times the request, given as "METHOD path", was received.
+func (f *fakeDatadog) requestCount(request string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	count := 0
+	for _, r := range f.requests {
+		if r == request {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (f *fakeDatadog) user(id string) *fakeUser {
+	for _, u := range f.users {
+		if u.ID == id {
+			return u
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeDatadog) role(id string) *fakeRole {
+	for _, r := range f.roles {
+		if r.ID == id {
+			return r
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeDatadog) team(id string) *fakeTeam {
+	for _, t := range f.teams {
+		if t.ID == id {
+			return t
+		}
+	}
+
+	return nil
+}
+
+func (t *fakeTeam) membership(userID string) *fakeMembership {
+	for i := range t.Memberships {
+		if t.Memberships[i].UserID == userID {
+			return &t.Memberships[i]
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeDatadog) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	if r.Header.Get("DD-API-KEY") != f.apiKey {
+		writeFakeError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+	// Validating the API key is the only call that does not need an application key.
+	if r.URL.Path != "/api/v1/validate" && r.Header.Get("DD-APPLICATION-KEY") != f.appKey {
+		writeFakeError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	key := r.Method + " " + r.URL.Path
+	if failures := f.failures[key]; len(failures) != 0 {
+		f.failures[key] = failures[1:]
+		w.Header().Set("Content-Type", "application/json")
+		if failures[0].Status == http.StatusTooManyRequests {
+			w.Header().Set("X-RateLimit-Limit", "100")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			// Resetting immediately lets the client retry without waiting.
+			w.Header().Set("X-RateLimit-Reset", "0")
+		}
+		w.WriteHeader(failures[0].Status)
+		_, _ = w.Write([]byte(failures[0].Body))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/validate":
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"valid": true})
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/users":
+		f.listUsers(w, r)
+	case r.Method == http.MethodGet && len(parts) == 4 && parts[2] == "users":
+		f.getUser(w, parts[3])
+	case r.Method == http.MethodGet && len(parts) == 5 && parts[2] == "users" && parts[4] == "permissions":
+		f.listUserPermissions(w, parts[3])
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/current_user/application_keys":
+		f.listApplicationKeys(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/permissions":
+		f.listPermissions(w)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/roles":
+		f.listRoles(w, r)
+	case r.Method == http.MethodGet && len(parts) == 4 && parts[2] == "roles":
+		f.getRole(w, parts[3])
+	case len(parts) == 5 && parts[2] == "roles" && parts[4] == "users":
+		f.roleUsers(w, r, parts[3])
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/authn_mappings":
+		f.listMappings(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/team":
+		f.listTeams(w, r)
+	case r.Method == http.MethodGet && len(parts) == 4 && parts[2] == "team":
+		f.getTeam(w, parts[3])
+	case len(parts) == 5 && parts[2] == "team" && parts[4] == "memberships":
+		f.teamMemberships(w, r, parts[3])
+	case len(parts) == 6 && parts[2] == "team" && parts[4] == "memberships":
+		f.teamMembership(w, r, parts[3], parts[5])
+	case r.Method == http.MethodGet && len(parts) == 5 && parts[2] == "team" && parts[4] == "permission-settings":
+		f.listTeamPermissionSettings(w, parts[3])
+	case r.Method == http.MethodPut && len(parts) == 6 && parts[2] == "team" && parts[4] == "permission-settings":
+		f.updateTeamPermissionSetting(w, r, parts[3], parts[5])
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/logs/config/archives":
+		f.listArchives(w)
+	case r.Method == http.MethodGet && len(parts) == 6 && parts[4] == "archives":
+		f.getArchive(w, parts[5])
+	case len(parts) == 7 && parts[4] == "archives" && parts[6] == "readers":
+		f.archiveReaders(w, r, parts[5])
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/services/definitions":
+		f.listServiceDefinitions(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/integration/aws":
+		f.listAWSAccounts(w)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/integration/gcp":
+		f.listGCPAccounts(w)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/integration/azure":
+		f.listAzureAccounts(w)
+	case r.Method == http.MethodGet && (strings.HasPrefix(r.URL.Path, "/api/v2/integrations/") || strings.HasPrefix(r.URL.Path, "/api/v2/integration/")):
+		f.listIntegrationAccounts(w, r.URL.Path)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/v1/integration/") && strings.Contains(r.URL.Path, "/configuration/"):
+		f.getNamedIntegration(w, r.URL.Path)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/security_monitoring/rules":
+		f.listSecurityRules(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/security_monitoring/configuration/security_filters":
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": []interface{}{
+			map[string]interface{}{
+				"id":   "sf-logs",
+				"type": "security_filters",
+				"attributes": map[string]interface{}{
+					"name":               "Default security filter",
+					"query":              "*",
+					"filtered_data_type": "logs",
+					"is_builtin":         true,
+					"is_enabled":         true,
+					"version":            1,
+				},
+			},
+		}})
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/sensitive-data-scanner/config":
+		f.getScannerConfiguration(w)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/ip_allowlist":
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": f.ipAllowlistJSON()})
+	case r.Method == http.MethodPatch && r.URL.Path == "/api/v2/ip_allowlist":
+		f.updateIPAllowlist(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/teams":
+		f.listIncidentGroups(w, r, "teams", f.incidentTeams)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/services":
+		f.listIncidentGroups(w, r, "services", f.incidentServices)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/synthetics/variables":
+		f.listGlobalVariables(w)
+	case r.Method == http.MethodGet && len(parts) == 5 && parts[2] == "synthetics" && parts[3] == "variables":
+		f.getGlobalVariable(w, parts[4])
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/synthetics/tests":
+		f.listSyntheticsTests(w, r)
+	case r.Method == http.MethodGet && len(parts) == 5 && parts[2] == "synthetics" && parts[3] == "tests":
+		f.getSyntheticsTest(w, parts[4])
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/synthetics/locations":
+		f.listLocations(w)
+	case r.Method == http.MethodGet && len(parts) == 5 && parts[2] == "synthetics" && parts[3] == "private-locations":
+		f.getPrivateLocation(w, parts[4])
+	default:
+		writeFakeError(w, http.StatusNotFound, fmt.Sprintf("fake Datadog API does not implement %s %s", r.Method, r.URL.Path))
+	}
+}
+
+func (f *fakeDatadog) listUsers(w http.ResponseWriter, r *http.Request) {
+	var data []interface{}
+	for _, u := range f.users {
+		data = append(data, fakeUserJSON(u))
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakePage(r, data)})
+}
+
+func (f *fakeDatadog) getUser(w http.ResponseWriter, id string) {
+	u := f.user(id)
+	if u == nil {
+		writeFakeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakeUserJSON(u)})
+}
+
+func (f *fakeDatadog) listUserPermissions(w http.ResponseWriter, id string) {
+	u := f.user(id)
+	if u == nil {
+		writeFakeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	data := []interface{}{}
+	for _, p := range f.permissions {
+		for _, roleID := range u.Roles {
+			if role := f.role(roleID); role != nil && containsString(role.Permissions, p.ID) {
+				data = append(data, map[string]interface{}{
+					"id":         p.ID,
+					"type":       "permissions",
+					"attributes": map[string]interface{}{"name": p.Name},
+				})
+				break
+			}
+		}
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+func (f *fakeDatadog) listApplicationKeys(w http.ResponseWriter, r *http.Request) {
+	var scopes interface{}
+	if f.appKeyScopes != nil {
+		scopes = f.appKeyScopes
+	}
+
+	data := []interface{}{
+		map[string]interface{}{
+			"id":   "k-other",
+			"type": "application_keys",
+			"attributes": map[string]interface{}{
+				"name":  "other",
+				"last4": "zzzz",
+			},
+		},
+		map[string]interface{}{
+			"id":   "k-connector",
+			"type": "application_keys",
+			"attributes": map[string]interface{}{
+				"name":   "baton",
+				"last4":  f.appKey[len(f.appKey)-4:],
+				"scopes": scopes,
+			},
+			"relationships": map[string]interface{}{
+				"owned_by": map[string]interface{}{
+					"data": map[string]interface{}{"id": f.appKeyOwner, "type": "users"},
+				},
+			},
+		},
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakePage(r, data)})
+}
+
+func (f *fakeDatadog) listPermissions(w http.ResponseWriter) {
+	data := make([]interface{}, 0, len(f.permissions))
+	for _, p := range f.permissions {
+		data = append(data, map[string]interface{}{
+			"id":         p.ID,
+			"type":       "permissions",
+			"attributes": map[string]interface{}{"name": p.Name},
+		})
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+func (f *fakeDatadog) listRoles(w http.ResponseWriter, r *http.Request) {
+	var data []interface{}
+	for _, role := range f.roles {
+		data = append(data, fakeRoleJSON(role))
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakePage(r, data)})
+}
+
+func (f *fakeDatadog) getRole(w http.ResponseWriter, id string) {
+	role := f.role(id)
+	if role == nil {
+		writeFakeError(w, http.StatusNotFound, "Role not found")
+		return
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakeRoleJSON(role)})
+}
+
+func (f *fakeDatadog) roleUsers(w http.ResponseWriter, r *http.Request, roleID string) {
+	role := f.role(roleID)
+	if role == nil {
+		writeFakeError(w, http.StatusNotFound, "Role not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var data []interface{}
+		for _, u := range f.users {
+			if containsString(u.Roles, roleID) {
+				data = append(data, fakeUserJSON(u))
+			}
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakePage(r, data)})
+	case http.MethodPost, http.MethodDelete:
+		userID, ok := f.decodeRelationshipID(w, r)
+		if !ok {
+			return
+		}
+		u := f.user(userID)
+		if u == nil {
+			writeFakeError(w, http.StatusNotFound, "User not found")
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			if containsString(u.Roles, roleID) {
+				writeFakeError(w, http.StatusConflict, "User is already a member of the role")
+				return
+			}
+			u.Roles = append(u.Roles, roleID)
+		} else {
+			if !containsString(u.Roles, roleID) {
+				writeFakeError(w, http.StatusNotFound, "User is not a member of the role")
+				return
+			}
+			u.Roles = removeString(u.Roles, roleID)
+		}
+
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": []interface{}{fakeUserJSON(u)}})
+	default:
+		writeFakeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (f *fakeDatadog) listMappings(w http.ResponseWriter, r *http.Request) {
+	if f.mappingsStatus != 0 {
+		writeFakeError(w, f.mappingsStatus, "Forbidden")
+		return
+	}
+
+	var data []interface{}
+	for _, m := range f.mappings {
+		data = append(data, map[string]interface{}{
+			"id":   m.ID,
+			"type": "authn_mappings",
+			"attributes": map[string]interface{}{
+				"attribute_key":   m.AttributeKey,
+				"attribute_value": m.AttributeValue,
+			},
+			"relationships": map[string]interface{}{
+				"team": map[string]interface{}{
+					"data": map[string]interface{}{"id": m.TeamID, "type": "team"},
+				},
+			},
+		})
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakePage(r, data)})
+}
+
+func (f *fakeDatadog) listTeams(w http.ResponseWriter, r *http.Request) {
+	includeLinks := false
+	for _, include := range r.URL.Query()["include"] {
+		if include == "team_links" {
+			includeLinks = true
+		}
+	}
+
+	var data []interface{}
+	for _, t := range f.teams {
+		data = append(data, fakeTeamJSON(t))
+	}
+	data = fakePage(r, data)
+
+	included := []interface{}{}
+	if includeLinks {
+		for _, item := range data {
+			t := f.team(item.(map[string]interface{})["id"].(string))
+			for _, link := range t.Links {
+				included = append(included, map[string]interface{}{
+					"id":   link.ID,
+					"type": "team_links",
+					"attributes": map[string]interface{}{
+						"label":   link.Label,
+						"url":     link.URL,
+						"team_id": t.ID,
+					},
+				})
+			}
+		}
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": data, "included": included})
+}
+
+func (f *fakeDatadog) getTeam(w http.ResponseWriter, id string) {
+	t := f.team(id)
+	if t == nil {
+		writeFakeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakeTeamJSON(t)})
+}
+
+func (f *fakeDatadog) teamMemberships(w http.ResponseWriter, r *http.Request, teamID string) {
+	t := f.team(teamID)
+	if t == nil {
+		writeFakeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var data []interface{}
+		for _, m := range t.Memberships {
+			data = append(data, fakeMembershipJSON(t, m))
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakePage(r, data)})
+	case http.MethodPost:
+		var body struct {
+			Data struct {
+				Attributes struct {
+					Role *string `json:"role"`
+				} `json:"attributes"`
+				Relationships struct {
+					User struct {
+						Data struct {
+							ID string `json:"id"`
+						} `json:"data"`
+					} `json:"user"`
+				} `json:"relationships"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeFakeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		userID := body.Data.Relationships.User.Data.ID
+		if f.user(userID) == nil {
+			writeFakeError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		if t.membership(userID) != nil {
+			writeFakeError(w, http.StatusConflict, "User is already a member of the team")
+			return
+		}
+
+		m := fakeMembership{UserID: userID, Admin: body.Data.Attributes.Role != nil && *body.Data.Attributes.Role == "admin"}
+		t.Memberships = append(t.Memberships, m)
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakeMembershipJSON(t, m)})
+	default:
+		writeFakeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (f *fakeDatadog) teamMembership(w http.ResponseWriter, r *http.Request, teamID, userID string) {
+	t := f.team(teamID)
+	if t == nil {
+		writeFakeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+	m := t.membership(userID)
+	if m == nil {
+		writeFakeError(w, http.StatusNotFound, "Membership not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPatch:
+		var body struct {
+			Data struct {
+				Attributes struct {
+					Role *string `json:"role"`
+				} `json:"attributes"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeFakeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		m.Admin = body.Data.Attributes.Role != nil && *body.Data.Attributes.Role == "admin"
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakeMembershipJSON(t, *m)})
+	case http.MethodDelete:
+		var memberships []fakeMembership
+		for _, other := range t.Memberships {
+			if other.UserID != userID {
+				memberships = append(memberships, other)
+			}
+		}
+		t.Memberships = memberships
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (f *fakeDatadog) listTeamPermissionSettings(w http.ResponseWriter, teamID string) {
+	t := f.team(teamID)
+	if t == nil {
+		writeFakeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+
+	data := make([]interface{}, 0, len(teamPermissionActions))
+	for _, action := range teamPermissionActions {
+		data = append(data, fakePermissionSettingJSON(t, string(action)))
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+func (f *fakeDatadog) updateTeamPermissionSetting(w http.ResponseWriter, r *http.Request, teamID, action string) {
+	t := f.team(teamID)
+	if t == nil {
+		writeFakeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+
+	var body struct {
+		Data struct {
+			Attributes struct {
+				Value string `json:"value"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeFakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !containsString(fakePermissionSettingOptions, body.Data.Attributes.Value) {
+		writeFakeError(w, http.StatusBadRequest, fmt.Sprintf("invalid value %q", body.Data.Attributes.Value))
+		return
+	}
+
+	if t.Permissions == nil {
+		t.Permissions = make(map[string]string)
+	}
+	t.Permissions[action] = body.Data.Attributes.Value
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakePermissionSettingJSON(t, action)})
+}
+
+func (f *fakeDatadog) archive(id string) *fakeArchive {
+	for _, a := range f.archives {
+		if a.ID == id {
+			return a
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeDatadog) listArchives(w http.ResponseWriter) {
+	data := []interface{}{}
+	for _, a := range f.archives {
+		data = append(data, fakeArchiveJSON(a))
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+func (f *fakeDatadog) getArchive(w http.ResponseWriter, id string) {
+	a := f.archive(id)
+	if a == nil {
+		writeFakeError(w, http.StatusNotFound, "Archive not found")
+		return
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakeArchiveJSON(a)})
+}
+
+func (f *fakeDatadog) archiveReaders(w http.ResponseWriter, r *http.Request, archiveID string) {
+	a := f.archive(archiveID)
+	if a == nil {
+		writeFakeError(w, http.StatusNotFound, "Archive not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data := []interface{}{}
+		for _, roleID := range a.ReadRoles {
+			if role := f.role(roleID); role != nil {
+				data = append(data, fakeRoleJSON(role))
+			}
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+	case http.MethodPost:
+		roleID, ok := f.decodeRelationshipID(w, r)
+		if !ok {
+			return
+		}
+		if f.role(roleID) == nil {
+			writeFakeError(w, http.StatusNotFound, "Role not found")
+			return
+		}
+		if !containsString(a.ReadRoles, roleID) {
+			a.ReadRoles = append(a.ReadRoles, roleID)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		roleID, ok := f.decodeRelationshipID(w, r)
+		if !ok {
+			return
+		}
+		if !containsString(a.ReadRoles, roleID) {
+			writeFakeError(w, http.StatusNotFound, "Role is not a reader of the archive")
+			return
+		}
+		a.ReadRoles = removeString(a.ReadRoles, roleID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (f *fakeDatadog) listGlobalVariables(w http.ResponseWriter) {
+	variables := []interface{}{}
+	for _, v := range f.variables {
+		variables = append(variables, fakeGlobalVariableJSON(v))
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"variables": variables})
+}
+
+func (f *fakeDatadog) getGlobalVariable(w http.ResponseWriter, id string) {
+	for _, v := range f.variables {
+		if v.ID == id {
+			writeFakeJSON(w, http.StatusOK, fakeGlobalVariableJSON(v))
+			return
+		}
+	}
+
+	writeFakeError(w, http.StatusNotFound, "Global variable not found")
+}
+
+// listServiceDefinitions lists the services in the v2.2 schema, as requested by the connector.
+func (f *fakeDatadog) listServiceDefinitions(w http.ResponseWriter, r *http.Request) {
+	var definitions []interface{}
+	for _, service := range f.services {
+		var contacts []map[string]interface{}
+		for _, contact := range service.Contacts {
+			contacts = append(contacts, map[string]interface{}{"type": "email", "contact": contact})
+		}
+
+		definitions = append(definitions, map[string]interface{}{
+			"id":   "sd-" + service.Name,
+			"type": "service-definition",
+			"attributes": map[string]interface{}{
+				"schema": map[string]interface{}{
+					"schema-version": "v2.2",
+					"dd-service":     service.Name,
+					"team":           service.Team,
+					"tier":           service.Tier,
+					"contacts":       contacts,
+					"integrations": map[string]interface{}{
+						"pagerduty": map[string]interface{}{"service-url": "https://example.pagerduty.com/service-directory/" + service.Name},
+					},
+				},
+			},
+		})
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakePage(r, definitions)})
+}
+
+func (f *fakeDatadog) listAWSAccounts(w http.ResponseWriter) {
+	accounts := []interface{}{}
+	for _, account := range f.aws {
+		accounts = append(accounts, map[string]interface{}{
+			"account_id":                       account.ID,
+			"role_name":                        account.Name,
+			"account_specific_namespace_rules": map[string]bool{"ec2": true, "lambda": false},
+			"metrics_collection_enabled":       true,
+		})
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"accounts": accounts})
+}
+
+func (f *fakeDatadog) listGCPAccounts(w http.ResponseWriter) {
+	accounts := []interface{}{}
+	for _, account := range f.gcp {
+		accounts = append(accounts, map[string]interface{}{
+			"project_id":   account.Name,
+			"client_email": account.ID,
+			"client_id":    "1234567890",
+		})
+	}
+
+	writeFakeJSON(w, http.StatusOK, accounts)
+}
+
+func (f *fakeDatadog) listAzureAccounts(w http.ResponseWriter) {
+	accounts := []interface{}{}
+	for _, account := range f.azure {
+		accounts = append(accounts, map[string]interface{}{
+			"tenant_name":  account.Name,
+			"client_id":    account.ID,
+			"host_filters": "env:prod",
+		})
+	}
+
+	writeFakeJSON(w, http.StatusOK, accounts)
+}
+
+// listIntegrationAccounts lists the accounts of a third-party integration, with the attributes
+// of every integration since each client only reads its own.
+func (f *fakeDatadog) listIntegrationAccounts(w http.ResponseWriter, path string) {
+	data := []interface{}{}
+	for _, account := range f.integrations[path] {
+		data = append(data, map[string]interface{}{
+			"id":   account.ID,
+			"type": "account",
+			"attributes": map[string]interface{}{
+				"name":    account.Name,
+				"api_key": account.Name,
+				"region":  "us",
+			},
+		})
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+// getNamedIntegration reads a PagerDuty service, the channels of a Slack account or a webhook by name.
+func (f *fakeDatadog) getNamedIntegration(w http.ResponseWriter, path string) {
+	body, ok := f.namedIntegrations[path]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	writeFakeJSON(w, http.StatusOK, body)
+}
+
+func (f *fakeDatadog) listSecurityRules(w http.ResponseWriter, r *http.Request) {
+	var rules []interface{}
+	for _, rule := range f.securityRules {
+		body := map[string]interface{}{
+			"id":               rule.ID,
+			"name":             rule.Name,
+			"type":             rule.Type,
+			"isEnabled":        rule.Enabled,
+			"isDefault":        rule.IsDefault,
+			"isDeleted":        rule.Deleted,
+			"createdAt":        int64(1700000000000),
+			"creationAuthorId": int64(42),
+			"updateAuthorId":   int64(43),
+			"version":          int64(2),
+		}
+		if rule.Creator != "" {
+			body["creator"] = map[string]interface{}{"handle": rule.Creator, "name": rule.Creator}
+			body["updater"] = map[string]interface{}{"handle": rule.Creator, "name": rule.Creator}
+		}
+		rules = append(rules, body)
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakePage(r, rules)})
+}
+
+func (f *fakeDatadog) getScannerConfiguration(w http.ResponseWriter) {
+	groupRefs := []interface{}{}
+	included := []interface{}{}
+	for _, group := range f.scannerGroups {
+		ruleRefs := []interface{}{}
+		for _, ruleID := range group.Rules {
+			ruleRefs = append(ruleRefs, map[string]interface{}{"id": ruleID, "type": "sensitive_data_scanner_rule"})
+			included = append(included, map[string]interface{}{
+				"id":   ruleID,
+				"type": "sensitive_data_scanner_rule",
+				"attributes": map[string]interface{}{
+					"name":       ruleID,
+					"is_enabled": true,
+					"pattern":    "[0-9]{16}",
+					"text_replacement": map[string]interface{}{
+						"type":               "replacement_string",
+						"replacement_string": "[redacted]",
+					},
+				},
+				"relationships": map[string]interface{}{
+					"group": map[string]interface{}{"data": map[string]interface{}{"id": group.ID, "type": "sensitive_data_scanner_group"}},
+				},
+			})
+		}
+
+		groupRef := map[string]interface{}{"id": group.ID, "type": "sensitive_data_scanner_group"}
+		groupRefs = append(groupRefs, groupRef)
+		included = append(included, map[string]interface{}{
+			"id":   group.ID,
+			"type": "sensitive_data_scanner_group",
+			"attributes": map[string]interface{}{
+				"name":         group.Name,
+				"is_enabled":   group.Enabled,
+				"filter":       map[string]interface{}{"query": "*"},
+				"product_list": []string{"logs"},
+			},
+			"relationships": map[string]interface{}{
+				"rules": map[string]interface{}{"data": ruleRefs},
+			},
+		})
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"id":            "sds-config",
+			"type":          "sensitive_data_scanner_configuration",
+			"relationships": map[string]interface{}{"groups": map[string]interface{}{"data": groupRefs}},
+		},
+		"included": included,
+	})
+}
+
+func (f *fakeDatadog) ipAllowlistJSON() map[string]interface{} {
+	entries := []interface{}{}
+	for _, entry := range f.ipAllowlist {
+		entries = append(entries, map[string]interface{}{
+			"data": map[string]interface{}{
+				"id":   "entry-" + entry.CIDR,
+				"type": "ip_allowlist_entry",
+				"attributes": map[string]interface{}{
+					"cidr_block":  entry.CIDR,
+					"note":        entry.Note,
+					"created_at":  "2024-01-02T03:04:05Z",
+					"modified_at": "2024-01-02T03:04:05Z",
+				},
+			},
+		})
+	}
+
+	return map[string]interface{}{
+		"id":   "ip-allowlist",
+		"type": "ip_allowlist",
+		"attributes": map[string]interface{}{
+			"enabled": f.ipAllowlistEnabled,
+			"entries": entries,
+		},
+	}
+}
+
+// updateIPAllowlist replaces the IP allowlist, rejecting an enforced allowlist without entries like Datadog
+// rejects changes that would lock out the caller.
+func (f *fakeDatadog) updateIPAllowlist(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Data struct {
+			Attributes struct {
+				Enabled bool `json:"enabled"`
+				Entries []struct {
+					Data struct {
+						Attributes struct {
+							CIDRBlock string `json:"cidr_block"`
+							Note      string `json:"note"`
+						} `json:"attributes"`
+					} `json:"data"`
+				} `json:"entries"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeFakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.Data.Attributes.Enabled && len(body.Data.Attributes.Entries) == 0 {
+		writeFakeError(w, http.StatusBadRequest, "an enforced IP allowlist needs at least one entry")
+		return
+	}
+
+	var entries []fakeIPAllowlistEntry
+	for _, entry := range body.Data.Attributes.Entries {
+		entries = append(entries, fakeIPAllowlistEntry{CIDR: entry.Data.Attributes.CIDRBlock, Note: entry.Data.Attributes.Note})
+	}
+	f.ipAllowlistEnabled = body.Data.Attributes.Enabled
+	f.ipAllowlist = entries
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": f.ipAllowlistJSON()})
+}
+
+func (f *fakeDatadog) listIncidentGroups(w http.ResponseWriter, r *http.Request, kind string, names map[string]string) {
+	ids := make([]string, 0, len(names))
+	for id := range names {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var groups []interface{}
+	for _, id := range ids {
+		groups = append(groups, map[string]interface{}{
+			"id":         id,
+			"type":       kind,
+			"attributes": map[string]interface{}{"name": names[id], "created": "2024-01-02T03:04:05Z"},
+			"relationships": map[string]interface{}{
+				"created_by": map[string]interface{}{"data": map[string]interface{}{"id": "u-alice", "type": "users"}},
+			},
+		})
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"data": fakePage(r, groups)})
+}
+
+func (f *fakeDatadog) listSyntheticsTests(w http.ResponseWriter, r *http.Request) {
+	var tests []interface{}
+	for _, st := range f.tests {
+		tests = append(tests, fakeSyntheticsTestJSON(st))
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"tests": fakePage(r, tests)})
+}
+
+func (f *fakeDatadog) getSyntheticsTest(w http.ResponseWriter, publicID string) {
+	for _, st := range f.tests {
+		if st.PublicID == publicID {
+			writeFakeJSON(w, http.StatusOK, fakeSyntheticsTestJSON(st))
+			return
+		}
+	}
+
+	writeFakeError(w, http.StatusNotFound, "Synthetic test not found")
+}
+
+// listLocations lists a managed location along with the private locations, as Datadog does.
+func (f *fakeDatadog) listLocations(w http.ResponseWriter) {
+	locations := []interface{}{
+		map[string]interface{}{"id": "aws:us-east-1", "name": "N. Virginia (AWS)"},
+	}
+	for _, l := range f.locations {
+		locations = append(locations, map[string]interface{}{"id": l.ID, "name": l.Name})
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"locations": locations})
+}
+
+func (f *fakeDatadog) getPrivateLocation(w http.ResponseWriter, id string) {
+	for _, l := range f.locations {
+		if l.ID == id {
+			writeFakeJSON(w, http.StatusOK, map[string]interface{}{
+				"id":          l.ID,
+				"name":        l.Name,
+				"description": "Private location " + l.Name,
+				"tags":        []string{},
+				"metadata":    map[string]interface{}{"restricted_roles": l.RestrictedRoles},
+			})
+			return
+		}
+	}
+
+	writeFakeError(w, http.StatusNotFound, "Private location not found")
+}
+
+// decodeRelationshipID reads the ID of a relationship request body such as the one adding a user to a role.
+func (f *fakeDatadog) decodeRelationshipID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var body struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeFakeError(w, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+
+	return body.Data.ID, true
+}
+
+var fakePermissionSettingOptions = []string{"admins", "members", "organization", "user_access_manage", "teams_manage"}
+
+func fakeUserJSON(u *fakeUser) map[string]interface{} {
+	roles := make([]interface{}, 0, len(u.Roles))
+	for _, id := range u.Roles {
+		roles = append(roles, map[string]interface{}{"id": id, "type": "roles"})
+	}
+
+	return map[string]interface{}{
+		"id":   u.ID,
+		"type": "users",
+		"attributes": map[string]interface{}{
+			"name":            u.Name,
+			"email":           u.Email,
+			"handle":          u.Email,
+			"status":          u.Status,
+			"service_account": u.ServiceAccount,
+		},
+		"relationships": map[string]interface{}{
+			"roles": map[string]interface{}{"data": roles},
+		},
+	}
+}
+
+func fakeArchiveJSON(a *fakeArchive) map[string]interface{} {
+	return map[string]interface{}{
+		"id":   a.ID,
+		"type": "archives",
+		"attributes": map[string]interface{}{
+			"name":  a.Name,
+			"query": a.Query,
+			"state": "WORKING",
+			"destination": map[string]interface{}{
+				"type":   "s3",
+				"bucket": a.Bucket,
+				"path":   "/",
+				"integration": map[string]interface{}{
+					"account_id": "123456789012",
+					"role_name":  "datadog-archives",
+				},
+			},
+		},
+	}
+}
+
+func fakeGlobalVariableJSON(v *fakeGlobalVariable) map[string]interface{} {
+	value := map[string]interface{}{"secure": v.Secure}
+	if !v.Secure {
+		value["value"] = "value of " + v.Name
+	}
+
+	return map[string]interface{}{
+		"id":          v.ID,
+		"name":        v.Name,
+		"description": "Global variable " + v.Name,
+		"tags":        []string{},
+		"value":       value,
+		"attributes":  map[string]interface{}{"restricted_roles": v.RestrictedRoles},
+	}
+}
+
+func fakeSyntheticsTestJSON(st *fakeSyntheticsTest) map[string]interface{} {
+	return map[string]interface{}{
+		"public_id":  st.PublicID,
+		"name":       st.Name,
+		"type":       st.Type,
+		"status":     st.Status,
+		"locations":  []string{"aws:us-east-1", "pl:office"},
+		"monitor_id": st.MonitorID,
+		"creator": map[string]interface{}{
+			"email":  st.CreatorEmail,
+			"handle": st.CreatorEmail,
+			"name":   st.CreatorEmail,
+		},
+		"options": map[string]interface{}{"restricted_roles": st.RestrictedRoles},
+	}
+}
+
+func fakeRoleJSON(role *fakeRole) map[string]interface{} {
+	permissions := make([]interface{}, 0, len(role.Permissions))
+	for _, id := range role.Permissions {
+		permissions = append(permissions, map[string]interface{}{"id": id, "type": "permissions"})
+	}
+
+	return map[string]interface{}{
+		"id":         role.ID,
+		"type":       "roles",
+		"attributes": map[string]interface{}{"name": role.Name},
+		"relationships": map[string]interface{}{
+			"permissions": map[string]interface{}{"data": permissions},
+		},
+	}
+}
+
+func fakeTeamJSON(t *fakeTeam) map[string]interface{} {
+	links := make([]interface{}, 0, len(t.Links))
+	for _, link := range t.Links {
+		links = append(links, map[string]interface{}{"id": link.ID, "type": "team_links"})
+	}
+
+	return map[string]interface{}{
+		"id":   t.ID,
+		"type": "team",
+		"attributes": map[string]interface{}{
+			"name":        t.Name,
+			"handle":      t.Handle,
+			"description": t.Description,
+			"user_count":  len(t.Memberships),
+			"link_count":  len(t.Links),
+		},
+		"relationships": map[string]interface{}{
+			"team_links": map[string]interface{}{"data": links},
+		},
+	}
+}
+
+func fakeMembershipJSON(t *fakeTeam, m fakeMembership) map[string]interface{} {
+	var role interface{}
+	if m.Admin {
+		role = "admin"
+	}
+
+	return map[string]interface{}{
+		"id":         t.ID + "-" + m.UserID,
+		"type":       "team_memberships",
+		"attributes": map[string]interface{}{"role": role},
+		"relationships": map[string]interface{}{
+			"user": map[string]interface{}{
+				"data": map[string]interface{}{"id": m.UserID, "type": "users"},
+			},
+		},
+	}
+}
+
+func fakePermissionSettingJSON(t *fakeTeam, action string) map[string]interface{} {
+	value, ok := t.Permissions[action]
+	if !ok {
+		value = string(defaultTeamPermissionValue)
+	}
+
+	return map[string]interface{}{
+		"id":   t.ID + "-" + action,
+		"type": "team_permission_settings",
+		"attributes": map[string]interface{}{
+			"action":   action,
+			"title":    strings.ReplaceAll(action, "_", " "),
+			"editable": true,
+			"value":    value,
+			"options":  fakePermissionSettingOptions,
+		},
+	}
+}
+
+// fakePage returns the page of items selected by the page[number] and page[size] query parameters.
+func fakePage(r *http.Request, items []interface{}) []interface{} {
+	size := fakeDefaultPageSize
+	// The v1 APIs name the paging parameters page_size and page_number.
+	for _, name := range []string{"page[size]", "page_size"} {
+		if v, err := strconv.Atoi(r.URL.Query().Get(name)); err == nil && v > 0 {
+			size = v
+		}
+	}
+	number, _ := strconv.Atoi(r.URL.Query().Get("page[number]"))
+	if v, err := strconv.Atoi(r.URL.Query().Get("page_number")); err == nil {
+		number = v
+	}
+
+	start := number * size
+	// The incident APIs page by offset instead.
+	if v, err := strconv.Atoi(r.URL.Query().Get("page[offset]")); err == nil {
+		start = v
+	}
+	if start >= len(items) {
+		return []interface{}{}
+	}
+	end := start + size
+	if end > len(items) {
+		end = len(items)
+	}
+
+	return items[start:end]
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeFakeError(w http.ResponseWriter, status int, message string) {
+	writeFakeJSON(w, status, map[string]interface{}{"errors": []string{message}})
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func removeString(values []string, value string) []string {
+	var rv []string
+	for _, v := range values {
+		if v != value {
+			rv = append(rv, v)
+		}
+	}
+
+	return rv
+}
@@ -1,11 +1,9 @@
 package connector
 
 import (
-	"context"
 	"fmt"
 	"strconv"
 
-	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
@@ -17,27 +15,14 @@ func annotationsForUserResourceType() annotations.Annotations {
 	return annos
 }
 
-func withAuthContext(ctx context.Context, apiKey, appKey, site string) context.Context {
-	ctx = context.WithValue(
-		ctx,
-		datadog.ContextAPIKeys,
-		map[string]datadog.APIKey{
-			"apiKeyAuth": {
-				Key: apiKey,
-			},
-			"appKeyAuth": {
-				Key: appKey,
-			},
-		},
-	)
-
-	ctx = context.WithValue(ctx,
-		datadog.ContextServerVariables,
-		map[string]string{
-			"site": site,
-		})
+// stringsToInterfaces converts a string slice into a form accepted by resource profiles.
+func stringsToInterfaces(values []string) []interface{} {
+	rv := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		rv = append(rv, v)
+	}
 
-	return ctx
+	return rv
 }
 
 func parsePageToken(i string, resourceID *v2.ResourceId) (*pagination.Bag, int64, error) {
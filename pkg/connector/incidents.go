@@ -0,0 +1,232 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	incidentGroupMember = "member"
+
+	incidentsPageSize = 100
+)
+
+// incidentGroup is an incident team or incident service, the two share the same attributes.
+type incidentGroup struct {
+	ID             string
+	Name           string
+	Created        *time.Time
+	Modified       *time.Time
+	CreatedBy      string
+	LastModifiedBy string
+}
+
+// incidentGroupLister lists a page of incident teams or services starting at the offset, along with the response
+// of the listing call so that missing permissions can be told apart from other errors.
+type incidentGroupLister func(ctx context.Context, client *client, offset int64) ([]incidentGroup, *http.Response, error)
+
+// incidentGroupBuilder syncs the incident teams or the incident services of the organization, which responders
+// are paged into incidents. Datadog does not expose who belongs to them, so the member entitlement is granted
+// to the Datadog team of the same name when there is one, expandable to the members of that team.
+type incidentGroupBuilder struct {
+	resourceType *v2.ResourceType
+	client       *client
+	teamIndex    *teamIndex
+	kind         string
+	listGroups   incidentGroupLister
+}
+
+func (i *incidentGroupBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return i.resourceType
+}
+
+// Create a new connector resource for a Datadog incident team or incident service.
+func incidentGroupResource(group incidentGroup, resourceType *v2.ResourceType) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"name":             group.Name,
+		"created_by":       group.CreatedBy,
+		"last_modified_by": group.LastModifiedBy,
+	}
+	if group.Created != nil {
+		profile["created"] = group.Created.UTC().Format(time.RFC3339)
+	}
+	if group.Modified != nil {
+		profile["modified"] = group.Modified.UTC().Format(time.RFC3339)
+	}
+
+	ret, err := rs.NewGroupResource(
+		group.Name,
+		resourceType,
+		group.ID,
+		[]rs.GroupTraitOption{rs.WithGroupProfile(profile)},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// List returns the incident teams or services of the organization, paged by offset.
+func (i *incidentGroupBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ctx = i.client.WithAuth(ctx)
+
+	bag, page, err := parsePageToken(pToken.Token, &v2.ResourceId{ResourceType: i.resourceType.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	groups, resp, err := i.listGroups(ctx, i.client, page*incidentsPageSize)
+	if err != nil {
+		// Listing requires the incident_settings_read permission, without it incident teams and services are skipped.
+		if hasStatus(resp, http.StatusForbidden) {
+			l.Warn("baton-datadog: not allowed to list incident groups, skipping them", zap.String("kind", i.kind), zap.Error(err))
+			return nil, "", nil, nil
+		}
+		return nil, "", nil, wrapError(err, resp, fmt.Sprintf("error listing %ss", i.kind))
+	}
+
+	var rv []*v2.Resource
+	for _, group := range groups {
+		gr, err := incidentGroupResource(group, i.resourceType)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating %s resource: %w", i.kind, err)
+		}
+		rv = append(rv, gr)
+	}
+
+	nextPageToken := ""
+	if len(groups) != 0 {
+		nextPageToken, err = getPageTokenFromPage(bag, page+1)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("datadog-connector: failed to get token from page: %w", err)
+		}
+	}
+
+	return rv, nextPageToken, nil, nil
+}
+
+func (i *incidentGroupBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	responderOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(teamResourceType),
+		ent.WithDisplayName(fmt.Sprintf("%s %s %s", resource.DisplayName, i.kind, incidentGroupMember)),
+		ent.WithDescription(fmt.Sprintf("Member of %s Datadog %s, paged into its incidents", resource.DisplayName, i.kind)),
+	}
+
+	return []*v2.Entitlement{
+		ent.NewAssignmentEntitlement(resource, incidentGroupMember, responderOptions...),
+	}, "", nil, nil
+}
+
+// Grants returns the Datadog team named like the incident team or service as its member, expandable to the
+// members of the team. Incident teams and services without a team of the same name have no grants.
+func (i *incidentGroupBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	ctx = i.client.WithAuth(ctx)
+
+	teamID, ok, err := i.teamIndex.TeamIDByName(ctx, i.client, resource.DisplayName)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if !ok {
+		return nil, "", nil, nil
+	}
+
+	return []*v2.Grant{
+		grant.NewGrant(resource, incidentGroupMember, teamResourceID(teamID),
+			grant.WithGrantMetadata(map[string]interface{}{"matched_by": "name"}),
+			grant.WithAnnotation(&v2.GrantExpandable{
+				EntitlementIds: []string{teamMemberEntitlementID(teamID)},
+			})),
+	}, "", nil, nil
+}
+
+func listIncidentTeams(ctx context.Context, client *client, offset int64) ([]incidentGroup, *http.Response, error) {
+	api := datadogV2.NewIncidentTeamsApi(client.api)
+
+	teams, resp, err := api.ListIncidentTeams(ctx, *datadogV2.NewListIncidentTeamsOptionalParameters().
+		WithPageSize(incidentsPageSize).
+		WithPageOffset(offset))
+	if err != nil {
+		return nil, resp, err
+	}
+
+	var rv []incidentGroup
+	for _, team := range teams.GetData() {
+		attributes := team.GetAttributes()
+		relationships := team.GetRelationships()
+		createdBy := relationships.GetCreatedBy()
+		lastModifiedBy := relationships.GetLastModifiedBy()
+		rv = append(rv, incidentGroup{
+			ID:             team.GetId(),
+			Name:           attributes.GetName(),
+			Created:        attributes.Created,
+			Modified:       attributes.Modified,
+			CreatedBy:      createdBy.Data.GetId(),
+			LastModifiedBy: lastModifiedBy.Data.GetId(),
+		})
+	}
+
+	return rv, resp, nil
+}
+
+func listIncidentServices(ctx context.Context, client *client, offset int64) ([]incidentGroup, *http.Response, error) {
+	api := datadogV2.NewIncidentServicesApi(client.api)
+
+	services, resp, err := api.ListIncidentServices(ctx, *datadogV2.NewListIncidentServicesOptionalParameters().
+		WithPageSize(incidentsPageSize).
+		WithPageOffset(offset))
+	if err != nil {
+		return nil, resp, err
+	}
+
+	var rv []incidentGroup
+	for _, service := range services.GetData() {
+		attributes := service.GetAttributes()
+		relationships := service.GetRelationships()
+		createdBy := relationships.GetCreatedBy()
+		lastModifiedBy := relationships.GetLastModifiedBy()
+		rv = append(rv, incidentGroup{
+			ID:             service.GetId(),
+			Name:           attributes.GetName(),
+			Created:        attributes.Created,
+			Modified:       attributes.Modified,
+			CreatedBy:      createdBy.Data.GetId(),
+			LastModifiedBy: lastModifiedBy.Data.GetId(),
+		})
+	}
+
+	return rv, resp, nil
+}
+
+func newIncidentTeamBuilder(client *client, teamIndex *teamIndex) *incidentGroupBuilder {
+	return &incidentGroupBuilder{
+		resourceType: incidentTeamResourceType,
+		client:       client,
+		teamIndex:    teamIndex,
+		kind:         "incident team",
+		listGroups:   listIncidentTeams,
+	}
+}
+
+func newIncidentServiceBuilder(client *client, teamIndex *teamIndex) *incidentGroupBuilder {
+	return &incidentGroupBuilder{
+		resourceType: incidentServiceResourceType,
+		client:       client,
+		teamIndex:    teamIndex,
+		kind:         "incident service",
+		listGroups:   listIncidentServices,
+	}
+}
@@ -0,0 +1,365 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// integrationAccount is an account of a third-party integration, the external system Datadog holds credentials for.
+// The profile only carries metadata, never the credentials themselves.
+type integrationAccount struct {
+	ID      string
+	Name    string
+	Profile map[string]interface{}
+}
+
+// integrationAccountSource lists the accounts of one third-party integration. New integrations are synced
+// by adding a source to integrationAccountSources.
+type integrationAccountSource struct {
+	provider string
+	list     func(ctx context.Context, client *client) ([]integrationAccount, *http.Response, error)
+}
+
+// integrationAccountSources are the integrations whose accounts can be listed. The PagerDuty, Slack and Webhooks
+// integrations are only read by name, see namedIntegrationAccountSources.
+var integrationAccountSources = []integrationAccountSource{
+	{provider: "Cloudflare", list: listCloudflareAccounts},
+	{provider: "Confluent", list: listConfluentAccounts},
+	{provider: "Fastly", list: listFastlyAccounts},
+	{provider: "Opsgenie", list: listOpsgenieServices},
+}
+
+// namedIntegrationAccountSources returns the integration account sources, along with the PagerDuty services,
+// Slack accounts and webhooks of the given names. The API has no way to list them, so they are configured by name.
+func namedIntegrationAccountSources(pagerDutyServices, slackAccounts, webhooks []string) []integrationAccountSource {
+	sources := append([]integrationAccountSource(nil), integrationAccountSources...)
+	if len(pagerDutyServices) != 0 {
+		sources = append(sources, integrationAccountSource{provider: "PagerDuty", list: listPagerDutyServices(pagerDutyServices)})
+	}
+	if len(slackAccounts) != 0 {
+		sources = append(sources, integrationAccountSource{provider: "Slack", list: listSlackAccounts(slackAccounts)})
+	}
+	if len(webhooks) != 0 {
+		sources = append(sources, integrationAccountSource{provider: "Webhooks", list: listWebhooks(webhooks)})
+	}
+
+	return sources
+}
+
+type integrationAccountBuilder struct {
+	resourceType *v2.ResourceType
+	client       *client
+	sources      []integrationAccountSource
+}
+
+func (i *integrationAccountBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return i.resourceType
+}
+
+// Create a new connector resource for an account of a third-party integration. The ID is prefixed with
+// the provider since account IDs are only unique within an integration.
+func integrationAccountResource(provider string, account integrationAccount) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"provider":     provider,
+		"account_id":   account.ID,
+		"account_name": account.Name,
+	}
+	for key, value := range account.Profile {
+		profile[key] = value
+	}
+
+	ret, err := rs.NewAppResource(
+		account.Name,
+		integrationAccountResourceType,
+		fmt.Sprintf("%s:%s", provider, account.ID),
+		[]rs.AppTraitOption{rs.WithAppProfile(profile)},
+		rs.WithDescription(fmt.Sprintf("%s integration account", provider)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// List returns the accounts of the third-party integrations, one integration per page.
+func (i *integrationAccountBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ctx = i.client.WithAuth(ctx)
+
+	bag, page, err := parsePageToken(pToken.Token, &v2.ResourceId{ResourceType: i.resourceType.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if page >= int64(len(i.sources)) {
+		return nil, "", nil, nil
+	}
+
+	source := i.sources[page]
+	accounts, resp, err := source.list(ctx, i.client)
+	if err != nil {
+		// Integrations the key is not allowed to read are skipped.
+		if hasStatus(resp, http.StatusForbidden) {
+			l.Warn("baton-datadog: not allowed to list integration accounts, skipping them", zap.String("provider", source.provider), zap.Error(err))
+			accounts = nil
+		} else {
+			return nil, "", nil, wrapError(err, resp, fmt.Sprintf("error listing %s integration accounts", source.provider))
+		}
+	}
+
+	var rv []*v2.Resource
+	for _, account := range accounts {
+		ar, err := integrationAccountResource(source.provider, account)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating integration account resource: %w", err)
+		}
+		rv = append(rv, ar)
+	}
+
+	nextPageToken := ""
+	if page+1 < int64(len(i.sources)) {
+		nextPageToken, err = getPageTokenFromPage(bag, page+1)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("datadog-connector: failed to get token from page: %w", err)
+		}
+	}
+
+	return rv, nextPageToken, nil, nil
+}
+
+// Entitlements returns no entitlements, integration accounts are synced as an inventory only.
+func (i *integrationAccountBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// Grants returns no grants, integration accounts are synced as an inventory only.
+func (i *integrationAccountBuilder) Grants(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func listCloudflareAccounts(ctx context.Context, client *client) ([]integrationAccount, *http.Response, error) {
+	api := datadogV2.NewCloudflareIntegrationApi(client.api)
+
+	accounts, resp, err := api.ListCloudflareAccounts(ctx)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	var rv []integrationAccount
+	for _, account := range accounts.GetData() {
+		rv = append(rv, integrationAccount{
+			ID:   account.GetId(),
+			Name: account.Attributes.GetName(),
+			Profile: map[string]interface{}{
+				"email": account.Attributes.GetEmail(),
+			},
+		})
+	}
+
+	return rv, resp, nil
+}
+
+// listConfluentAccounts lists the Confluent Cloud accounts. Accounts have no name, they are named after
+// the last characters of their API key, the key itself is never synced.
+func listConfluentAccounts(ctx context.Context, client *client) ([]integrationAccount, *http.Response, error) {
+	api := datadogV2.NewConfluentCloudApi(client.api)
+
+	accounts, resp, err := api.ListConfluentAccount(ctx)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	var rv []integrationAccount
+	for _, account := range accounts.GetData() {
+		var resources []string
+		for _, resource := range account.Attributes.GetResources() {
+			resources = append(resources, fmt.Sprintf("%s:%s", resource.GetResourceType(), resource.GetId()))
+		}
+
+		rv = append(rv, integrationAccount{
+			ID:   account.GetId(),
+			Name: redactedKey(account.Attributes.GetApiKey()),
+			Profile: map[string]interface{}{
+				"resources": stringsToInterfaces(resources),
+				"tags":      stringsToInterfaces(account.Attributes.GetTags()),
+			},
+		})
+	}
+
+	return rv, resp, nil
+}
+
+func listFastlyAccounts(ctx context.Context, client *client) ([]integrationAccount, *http.Response, error) {
+	api := datadogV2.NewFastlyIntegrationApi(client.api)
+
+	accounts, resp, err := api.ListFastlyAccounts(ctx)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	var rv []integrationAccount
+	for _, account := range accounts.GetData() {
+		var services []string
+		for _, service := range account.Attributes.GetServices() {
+			services = append(services, service.GetId())
+		}
+
+		rv = append(rv, integrationAccount{
+			ID:   account.GetId(),
+			Name: account.Attributes.GetName(),
+			Profile: map[string]interface{}{
+				"services": stringsToInterfaces(services),
+			},
+		})
+	}
+
+	return rv, resp, nil
+}
+
+// listOpsgenieServices lists the Opsgenie services, each holding its own Opsgenie API key.
+func listOpsgenieServices(ctx context.Context, client *client) ([]integrationAccount, *http.Response, error) {
+	api := datadogV2.NewOpsgenieIntegrationApi(client.api)
+
+	services, resp, err := api.ListOpsgenieServices(ctx)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	var rv []integrationAccount
+	for _, service := range services.GetData() {
+		rv = append(rv, integrationAccount{
+			ID:   service.GetId(),
+			Name: service.Attributes.GetName(),
+			Profile: map[string]interface{}{
+				"region":     string(service.Attributes.GetRegion()),
+				"custom_url": service.Attributes.GetCustomUrl(),
+			},
+		})
+	}
+
+	return rv, resp, nil
+}
+
+// listPagerDutyServices reads the PagerDuty services of the given names. The service keys are never synced.
+func listPagerDutyServices(names []string) func(ctx context.Context, client *client) ([]integrationAccount, *http.Response, error) {
+	return func(ctx context.Context, client *client) ([]integrationAccount, *http.Response, error) {
+		api := datadogV1.NewPagerDutyIntegrationApi(client.api)
+
+		var rv []integrationAccount
+		for _, name := range names {
+			service, resp, err := api.GetPagerDutyIntegrationService(ctx, name)
+			if err != nil {
+				if hasStatus(resp, http.StatusNotFound) {
+					ctxzap.Extract(ctx).Warn("baton-datadog: PagerDuty service not found, skipping it", zap.String("service_name", name))
+					continue
+				}
+				return nil, resp, err
+			}
+
+			rv = append(rv, integrationAccount{
+				ID:   service.GetServiceName(),
+				Name: service.GetServiceName(),
+			})
+		}
+
+		return rv, nil, nil
+	}
+}
+
+// listSlackAccounts reads the Slack accounts of the given names, along with the channels they post to.
+func listSlackAccounts(names []string) func(ctx context.Context, client *client) ([]integrationAccount, *http.Response, error) {
+	return func(ctx context.Context, client *client) ([]integrationAccount, *http.Response, error) {
+		api := datadogV1.NewSlackIntegrationApi(client.api)
+
+		var rv []integrationAccount
+		for _, name := range names {
+			channels, resp, err := api.GetSlackIntegrationChannels(ctx, name)
+			if err != nil {
+				if hasStatus(resp, http.StatusNotFound) {
+					ctxzap.Extract(ctx).Warn("baton-datadog: Slack account not found, skipping it", zap.String("account_name", name))
+					continue
+				}
+				return nil, resp, err
+			}
+
+			var channelNames []string
+			for _, channel := range channels {
+				channelNames = append(channelNames, channel.GetName())
+			}
+
+			rv = append(rv, integrationAccount{
+				ID:   name,
+				Name: name,
+				Profile: map[string]interface{}{
+					"channels": stringsToInterfaces(channelNames),
+				},
+			})
+		}
+
+		return rv, nil, nil
+	}
+}
+
+// listWebhooks reads the webhooks of the given names. Only the host of their URL is synced, since URLs,
+// headers and payloads often embed tokens.
+func listWebhooks(names []string) func(ctx context.Context, client *client) ([]integrationAccount, *http.Response, error) {
+	return func(ctx context.Context, client *client) ([]integrationAccount, *http.Response, error) {
+		api := datadogV1.NewWebhooksIntegrationApi(client.api)
+
+		var rv []integrationAccount
+		for _, name := range names {
+			webhook, resp, err := api.GetWebhooksIntegration(ctx, name)
+			if err != nil {
+				if hasStatus(resp, http.StatusNotFound) {
+					ctxzap.Extract(ctx).Warn("baton-datadog: webhook not found, skipping it", zap.String("webhook_name", name))
+					continue
+				}
+				return nil, resp, err
+			}
+
+			host := ""
+			if u, err := url.Parse(webhook.GetUrl()); err == nil {
+				host = u.Hostname()
+			}
+
+			rv = append(rv, integrationAccount{
+				ID:   webhook.GetName(),
+				Name: webhook.GetName(),
+				Profile: map[string]interface{}{
+					"host":      host,
+					"encode_as": string(webhook.GetEncodeAs()),
+				},
+			})
+		}
+
+		return rv, nil, nil
+	}
+}
+
+// redactedKey returns a label showing the last 4 characters of the key at most, enough to tell keys apart.
+func redactedKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+
+	return "****" + key[len(key)-4:]
+}
+
+func newIntegrationAccountBuilder(client *client, sources []integrationAccountSource) *integrationAccountBuilder {
+	return &integrationAccountBuilder{
+		resourceType: integrationAccountResourceType,
+		client:       client,
+		sources:      sources,
+	}
+}
@@ -0,0 +1,481 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ipAllowlistID is the ID of the IP allowlist resource, an organization has a single allowlist.
+	ipAllowlistID = "ip_allowlist"
+
+	ipAllowlistEntry = "entry"
+)
+
+var errLastIPAllowlistEntry = status.Error(codes.FailedPrecondition, "baton-datadog: refusing to remove the last entry of an enforced IP allowlist")
+
+// ipAllowlistBuilder syncs the IP allowlist of the organization, with its entries as children. The entries are
+// the principals of the entry entitlement of the allowlist, granting it adds the CIDR block of the entry to the
+// allowlist and revoking it removes the block. Entries are identified by their network, see ipAllowlistEntryKey.
+type ipAllowlistBuilder struct {
+	resourceType *v2.ResourceType
+	client       *client
+	readOnly     bool
+	dryRun       bool
+}
+
+func (i *ipAllowlistBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return i.resourceType
+}
+
+// Create a new connector resource for the Datadog IP allowlist of the organization.
+func ipAllowlistResource(attributes *datadogV2.IPAllowlistAttributes) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"enabled":     attributes.GetEnabled(),
+		"entry_count": int64(len(attributes.GetEntries())),
+	}
+
+	ret, err := rs.NewAppResource(
+		"IP allowlist",
+		ipAllowlistResourceType,
+		ipAllowlistID,
+		[]rs.AppTraitOption{rs.WithAppProfile(profile)},
+		rs.WithDescription(ipAllowlistDescription(attributes.GetEnabled())),
+		rs.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: ipAllowlistEntryResourceType.Id}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func ipAllowlistDescription(enabled bool) string {
+	if enabled {
+		return "Networks allowed to reach the Datadog organization, the allowlist is enforced"
+	}
+
+	return "Networks allowed to reach the Datadog organization, the allowlist is not enforced"
+}
+
+// List returns the IP allowlist of the organization.
+func (i *ipAllowlistBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	ctx = i.client.WithAuth(ctx)
+
+	attributes, ok, err := getIPAllowlist(ctx, i.client)
+	if err != nil || !ok {
+		return nil, "", nil, err
+	}
+
+	ar, err := ipAllowlistResource(attributes)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("error creating IP allowlist resource: %w", err)
+	}
+
+	return []*v2.Resource{ar}, "", nil, nil
+}
+
+func (i *ipAllowlistBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	entryOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(ipAllowlistEntryResourceType),
+		ent.WithDisplayName(fmt.Sprintf("%s %s", resource.DisplayName, ipAllowlistEntry)),
+		ent.WithDescription("Network allowed to reach the Datadog organization when the IP allowlist is enforced"),
+	}
+
+	return []*v2.Entitlement{
+		ent.NewAssignmentEntitlement(resource, ipAllowlistEntry, entryOptions...),
+	}, "", nil, nil
+}
+
+// Grants returns the entries of the IP allowlist.
+func (i *ipAllowlistBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	ctx = i.client.WithAuth(ctx)
+
+	attributes, ok, err := getIPAllowlist(ctx, i.client)
+	if err != nil || !ok {
+		return nil, "", nil, err
+	}
+
+	// Entries of the same network are a single resource, as when listing them, so they are granted once.
+	var rv []*v2.Grant
+	granted := make(map[string]bool)
+	for _, entry := range attributes.GetEntries() {
+		key := ipAllowlistEntryKey(ipAllowlistEntryCIDR(entry))
+		if granted[key] {
+			continue
+		}
+		granted[key] = true
+
+		rv = append(rv, grant.NewGrant(resource, ipAllowlistEntry, ipAllowlistEntryResourceID(key)))
+	}
+
+	return rv, "", nil, nil
+}
+
+// Grant adds the CIDR block of the entry to the IP allowlist, with the note of the entry.
+func (i *ipAllowlistBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	if err := checkWritable(i.readOnly, "add an IP allowlist entry"); err != nil {
+		return nil, err
+	}
+
+	cidr, err := ipAllowlistPrincipalCIDR(principal)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = i.client.WithAuth(ctx)
+	if i.dryRun {
+		return i.planIPAllowlistEntry(ctx, cidr, true)
+	}
+
+	attributes, err := i.currentIPAllowlist(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, present := ipAllowlistWithout(attributes, cidr); present {
+		return noOpAnnotations("CIDR block is already in the IP allowlist")
+	}
+
+	entry := datadogV2.NewIPAllowlistEntryAttributes()
+	entry.SetCidrBlock(cidr)
+	entry.SetNote(ipAllowlistPrincipalNote(principal))
+	entryData := datadogV2.NewIPAllowlistEntryData(datadogV2.IPALLOWLISTENTRYTYPE_IP_ALLOWLIST_ENTRY)
+	entryData.SetAttributes(*entry)
+
+	entries := append(attributes.GetEntries(), *datadogV2.NewIPAllowlistEntry(*entryData))
+	err = i.updateIPAllowlist(ctx, attributes.GetEnabled(), entries, "baton-datadog: failed to add IP allowlist entry")
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// Revoke removes the CIDR block of the entry from the IP allowlist, along with the blocks naming the same network.
+// The last entries of an enforced allowlist are never removed, Datadog would otherwise block every request
+// to the organization.
+func (i *ipAllowlistBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	if err := checkWritable(i.readOnly, "remove an IP allowlist entry"); err != nil {
+		return nil, err
+	}
+
+	cidr, err := ipAllowlistPrincipalCIDR(grant.Principal)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = i.client.WithAuth(ctx)
+	if i.dryRun {
+		return i.planIPAllowlistEntry(ctx, cidr, false)
+	}
+
+	attributes, err := i.currentIPAllowlist(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries, present := ipAllowlistWithout(attributes, cidr)
+	if !present {
+		return noOpAnnotations("CIDR block is not in the IP allowlist")
+	}
+
+	if attributes.GetEnabled() && len(entries) == 0 {
+		return nil, errLastIPAllowlistEntry
+	}
+
+	err = i.updateIPAllowlist(ctx, attributes.GetEnabled(), entries, "baton-datadog: failed to remove IP allowlist entry")
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// currentIPAllowlist returns the IP allowlist before it is changed, failing if the key is not allowed to read it.
+func (i *ipAllowlistBuilder) currentIPAllowlist(ctx context.Context) (*datadogV2.IPAllowlistAttributes, error) {
+	api := datadogV2.NewIPAllowlistApi(i.client.api)
+
+	allowlist, resp, err := api.GetIPAllowlist(ctx)
+	if err != nil {
+		return nil, wrapError(err, resp, "baton-datadog: failed to get IP allowlist")
+	}
+
+	data := allowlist.GetData()
+	attributes := data.GetAttributes()
+	return &attributes, nil
+}
+
+// updateIPAllowlist replaces the entries of the IP allowlist, keeping its enforcement unchanged.
+func (i *ipAllowlistBuilder) updateIPAllowlist(ctx context.Context, enabled bool, entries []datadogV2.IPAllowlistEntry, operation string) error {
+	api := datadogV2.NewIPAllowlistApi(i.client.api)
+
+	attributes := datadogV2.NewIPAllowlistAttributes()
+	attributes.SetEnabled(enabled)
+	attributes.SetEntries(entries)
+	data := datadogV2.NewIPAllowlistData(datadogV2.IPALLOWLISTTYPE_IP_ALLOWLIST)
+	data.SetAttributes(*attributes)
+
+	_, resp, err := api.UpdateIPAllowlist(ctx, *datadogV2.NewIPAllowlistUpdateRequest(*data))
+	if err != nil {
+		return wrapError(err, resp, operation)
+	}
+
+	return nil
+}
+
+// getIPAllowlist returns the IP allowlist of the organization, ok is false when the key is not allowed to read it.
+func getIPAllowlist(ctx context.Context, client *client) (*datadogV2.IPAllowlistAttributes, bool, error) {
+	l := ctxzap.Extract(ctx)
+	api := datadogV2.NewIPAllowlistApi(client.api)
+
+	allowlist, resp, err := api.GetIPAllowlist(ctx)
+	if err != nil {
+		// Reading the allowlist requires the org_management permission, without it the allowlist is skipped.
+		if hasStatus(resp, http.StatusForbidden) {
+			l.Warn("baton-datadog: not allowed to read the IP allowlist, skipping it", zap.Error(err))
+			return nil, false, nil
+		}
+		return nil, false, wrapError(err, resp, "error getting IP allowlist")
+	}
+
+	data := allowlist.GetData()
+	attributes := data.GetAttributes()
+	return &attributes, true, nil
+}
+
+// ipAllowlistWithout returns the entries of the allowlist but those naming the network of the CIDR block,
+// and whether there were any.
+func ipAllowlistWithout(attributes *datadogV2.IPAllowlistAttributes, cidr string) ([]datadogV2.IPAllowlistEntry, bool) {
+	key := ipAllowlistEntryKey(cidr)
+
+	var rv []datadogV2.IPAllowlistEntry
+	present := false
+	for _, entry := range attributes.GetEntries() {
+		if ipAllowlistEntryKey(ipAllowlistEntryCIDR(entry)) == key {
+			present = true
+			continue
+		}
+		rv = append(rv, entry)
+	}
+
+	return rv, present
+}
+
+func ipAllowlistEntryCIDR(entry datadogV2.IPAllowlistEntry) string {
+	return entry.Data.Attributes.GetCidrBlock()
+}
+
+// parseIPAllowlistCIDR returns the network of the CIDR block or IP address, an IP address being
+// the network of that single address. Host bits of a CIDR block are dropped.
+func parseIPAllowlistCIDR(cidr string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(cidr); err == nil {
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(cidr)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ipAllowlistEntryKey returns the network of the CIDR block or IP address, so that e.g. 203.0.113.7 and
+// 203.0.113.7/32, or 10.0.0.1/8 and 10.0.0.0/8, name the same entry. Blocks that do not parse are kept as is.
+func ipAllowlistEntryKey(cidr string) string {
+	prefix, err := parseIPAllowlistCIDR(cidr)
+	if err != nil {
+		return cidr
+	}
+
+	return prefix.String()
+}
+
+// ipAllowlistPrincipalCIDR returns the network of the entry a provisioning action applies to.
+// Datadog accepts single IP addresses as well as CIDR blocks.
+func ipAllowlistPrincipalCIDR(principal *v2.Resource) (string, error) {
+	if principal.Id.ResourceType != ipAllowlistEntryResourceType.Id {
+		return "", status.Error(codes.InvalidArgument, "baton-datadog: only IP allowlist entries can be added to the IP allowlist")
+	}
+
+	prefix, err := parseIPAllowlistCIDR(principal.Id.Resource)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "baton-datadog: %q is not a CIDR block or IP address", principal.Id.Resource)
+	}
+
+	return prefix.String(), nil
+}
+
+// ipAllowlistPrincipalNote returns the note of the entry a provisioning action applies to, read from
+// its profile or its description.
+func ipAllowlistPrincipalNote(principal *v2.Resource) string {
+	if appTrait, err := rs.GetAppTrait(principal); err == nil {
+		if note, ok := rs.GetProfileStringValue(appTrait.Profile, "note"); ok {
+			return note
+		}
+	}
+
+	return principal.Description
+}
+
+func newIPAllowlistBuilder(client *client, readOnly, dryRun bool) *ipAllowlistBuilder {
+	return &ipAllowlistBuilder{
+		resourceType: ipAllowlistResourceType,
+		client:       client,
+		readOnly:     readOnly,
+		dryRun:       dryRun,
+	}
+}
+
+// ipAllowlistEntryBuilder syncs the entries of the IP allowlist, along with the configured entries that are
+// not in the allowlist yet so they can be granted to it.
+type ipAllowlistEntryBuilder struct {
+	resourceType *v2.ResourceType
+	client       *client
+	configured   []datadogV2.IPAllowlistEntry
+}
+
+func (i *ipAllowlistEntryBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return i.resourceType
+}
+
+// Create a new connector resource for an entry of the Datadog IP allowlist, a child of the allowlist.
+// inAllowlist is false for configured entries that are not in the allowlist.
+func ipAllowlistEntryResource(entry datadogV2.IPAllowlistEntry, enabled, inAllowlist bool, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	attributes := entry.Data.GetAttributes()
+
+	profile := map[string]interface{}{
+		"cidr_block":        attributes.GetCidrBlock(),
+		"note":              attributes.GetNote(),
+		"allowlist_enabled": enabled,
+		"in_allowlist":      inAllowlist,
+	}
+	if attributes.HasCreatedAt() {
+		profile["created_at"] = attributes.GetCreatedAt().UTC().Format(time.RFC3339)
+	}
+	if attributes.HasModifiedAt() {
+		profile["modified_at"] = attributes.GetModifiedAt().UTC().Format(time.RFC3339)
+	}
+
+	ret, err := rs.NewAppResource(
+		attributes.GetCidrBlock(),
+		ipAllowlistEntryResourceType,
+		ipAllowlistEntryKey(attributes.GetCidrBlock()),
+		[]rs.AppTraitOption{rs.WithAppProfile(profile)},
+		rs.WithDescription(attributes.GetNote()),
+		rs.WithParentResourceID(parentResourceID),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// List returns the entries of the IP allowlist given as parent, followed by the configured entries missing from it.
+// Entries are only listed as children of the allowlist.
+func (i *ipAllowlistEntryBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID == nil || parentResourceID.ResourceType != ipAllowlistResourceType.Id {
+		return nil, "", nil, nil
+	}
+
+	ctx = i.client.WithAuth(ctx)
+
+	attributes, ok, err := getIPAllowlist(ctx, i.client)
+	if err != nil || !ok {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Resource
+	listed := make(map[string]bool)
+	for _, entry := range attributes.GetEntries() {
+		key := ipAllowlistEntryKey(ipAllowlistEntryCIDR(entry))
+		if listed[key] {
+			continue
+		}
+		listed[key] = true
+
+		er, err := ipAllowlistEntryResource(entry, attributes.GetEnabled(), true, parentResourceID)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating IP allowlist entry resource: %w", err)
+		}
+		rv = append(rv, er)
+	}
+
+	for _, entry := range i.configured {
+		key := ipAllowlistEntryKey(ipAllowlistEntryCIDR(entry))
+		if listed[key] {
+			continue
+		}
+		listed[key] = true
+
+		er, err := ipAllowlistEntryResource(entry, attributes.GetEnabled(), false, parentResourceID)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating IP allowlist entry resource: %w", err)
+		}
+		rv = append(rv, er)
+	}
+
+	return rv, "", nil, nil
+}
+
+func (i *ipAllowlistEntryBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (i *ipAllowlistEntryBuilder) Grants(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// parseIPAllowlistEntries parses the configured IP allowlist entries, each a CIDR block or IP address
+// optionally followed by = and the note of the entry.
+func parseIPAllowlistEntries(entries []string) ([]datadogV2.IPAllowlistEntry, error) {
+	var rv []datadogV2.IPAllowlistEntry
+	for _, value := range entries {
+		cidr, note, _ := strings.Cut(value, "=")
+		prefix, err := parseIPAllowlistCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("baton-datadog: IP allowlist entry %q is not a CIDR block or IP address", value)
+		}
+
+		attributes := datadogV2.NewIPAllowlistEntryAttributes()
+		attributes.SetCidrBlock(prefix.String())
+		attributes.SetNote(strings.TrimSpace(note))
+		data := datadogV2.NewIPAllowlistEntryData(datadogV2.IPALLOWLISTENTRYTYPE_IP_ALLOWLIST_ENTRY)
+		data.SetAttributes(*attributes)
+		rv = append(rv, *datadogV2.NewIPAllowlistEntry(*data))
+	}
+
+	return rv, nil
+}
+
+// ipAllowlistEntryResourceID returns the resource ID of the IP allowlist entry with the given CIDR block.
+func ipAllowlistEntryResourceID(cidr string) *v2.ResourceId {
+	return &v2.ResourceId{
+		ResourceType: ipAllowlistEntryResourceType.Id,
+		Resource:     cidr,
+	}
+}
+
+func newIPAllowlistEntryBuilder(client *client, configured []datadogV2.IPAllowlistEntry) *ipAllowlistEntryBuilder {
+	return &ipAllowlistEntryBuilder{
+		resourceType: ipAllowlistEntryResourceType,
+		client:       client,
+		configured:   configured,
+	}
+}
@@ -0,0 +1,264 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const archiveReader = "reader"
+
+type logsArchiveBuilder struct {
+	resourceType *v2.ResourceType
+	client       *client
+	readOnly     bool
+	dryRun       bool
+}
+
+func (a *logsArchiveBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return a.resourceType
+}
+
+// Create a new connector resource for a Datadog logs archive. The IDs of its read roles are recorded in the
+// profile, since archives are listed without them.
+func logsArchiveResource(archive *datadogV2.LogsArchiveDefinition, readRoles []string) (*v2.Resource, error) {
+	attributes := archive.GetAttributes()
+	destinationType, location := archiveDestination(attributes.GetDestination())
+
+	description := fmt.Sprintf("%s archive of logs matching %q", destinationType, attributes.GetQuery())
+	if location != "" {
+		description = fmt.Sprintf("%s stored in %s", description, location)
+	}
+
+	profile := map[string]interface{}{
+		"archive_id":       archive.GetId(),
+		"archive_name":     attributes.GetName(),
+		"destination_type": destinationType,
+		"destination":      location,
+		"query":            attributes.GetQuery(),
+		"state":            string(attributes.GetState()),
+		"read_roles":       stringsToInterfaces(readRoles),
+	}
+
+	ret, err := rs.NewAppResource(
+		attributes.GetName(),
+		logsArchiveResourceType,
+		archive.GetId(),
+		[]rs.AppTraitOption{rs.WithAppProfile(profile)},
+		rs.WithDescription(description),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// archiveDestination returns the kind of storage an archive writes to and the bucket or container it uses.
+func archiveDestination(destination datadogV2.LogsArchiveDestination) (string, string) {
+	switch {
+	case destination.LogsArchiveDestinationS3 != nil:
+		return "S3", destination.LogsArchiveDestinationS3.GetBucket()
+	case destination.LogsArchiveDestinationGCS != nil:
+		return "GCS", destination.LogsArchiveDestinationGCS.GetBucket()
+	case destination.LogsArchiveDestinationAzure != nil:
+		return "Azure", destination.LogsArchiveDestinationAzure.GetContainer()
+	default:
+		return "Logs", ""
+	}
+}
+
+// List returns all the logs archives of the organization. Archives are not paginated.
+func (a *logsArchiveBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ctx = a.client.WithAuth(ctx)
+	api := datadogV2.NewLogsArchivesApi(a.client.api)
+
+	archives, resp, err := api.ListLogsArchives(ctx)
+	if err != nil {
+		// Listing archives requires the logs_read_archives permission, without it archives are skipped.
+		if hasStatus(resp, http.StatusForbidden) {
+			l.Warn("baton-datadog: not allowed to list logs archives, skipping them", zap.Error(err))
+			return nil, "", nil, nil
+		}
+		return nil, "", nil, wrapError(err, resp, "error listing logs archives")
+	}
+
+	var rv []*v2.Resource
+	for _, archive := range archives.GetData() {
+		roles, resp, err := api.ListArchiveReadRoles(ctx, archive.GetId())
+		if err != nil {
+			return nil, "", nil, wrapError(err, resp, fmt.Sprintf("error listing read roles of logs archive %s", archive.GetId()))
+		}
+
+		var readRoles []string
+		for _, role := range roles.GetData() {
+			readRoles = append(readRoles, role.GetId())
+		}
+
+		archiveCopy := archive
+		ar, err := logsArchiveResource(&archiveCopy, readRoles)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating logs archive resource: %w", err)
+		}
+		rv = append(rv, ar)
+	}
+
+	return rv, "", nil, nil
+}
+
+func (a *logsArchiveBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	readerOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(roleResourceType),
+		ent.WithDisplayName(fmt.Sprintf("%s Logs Archive %s", resource.DisplayName, archiveReader)),
+		ent.WithDescription(fmt.Sprintf("Can read and rehydrate logs from %s Datadog logs archive", resource.DisplayName)),
+	}
+
+	return []*v2.Entitlement{
+		ent.NewPermissionEntitlement(resource, archiveReader, readerOptions...),
+	}, "", nil, nil
+}
+
+// Grants returns the roles allowed to read the archive, recorded when listing it, expandable to the members of each role.
+// An archive without read roles can be read by every user holding the logs_read_archives permission,
+// it has no grants since that access is not specific to the archive.
+func (a *logsArchiveBuilder) Grants(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	appTrait, err := rs.GetAppTrait(resource)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("error reading profile of logs archive %s: %w", resource.Id.Resource, err)
+	}
+
+	var rv []*v2.Grant
+	for _, value := range appTrait.GetProfile().GetFields()["read_roles"].GetListValue().GetValues() {
+		roleID := value.GetStringValue()
+		rv = append(rv, grant.NewGrant(resource, archiveReader, roleResourceID(roleID), grant.WithAnnotation(&v2.GrantExpandable{
+			EntitlementIds: []string{roleMemberEntitlementID(roleID)},
+		})))
+	}
+
+	return rv, "", nil, nil
+}
+
+// Grant adds the role to the read roles of the archive. Adding the first read role restricts the archive
+// to that role, users relying on the logs_read_archives permission alone lose access to it.
+func (a *logsArchiveBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	if err := checkWritable(a.readOnly, "grant logs archive read access"); err != nil {
+		return nil, err
+	}
+
+	if principal.Id.ResourceType != roleResourceType.Id {
+		return nil, status.Error(codes.InvalidArgument, "baton-datadog: only roles can be granted logs archive read access")
+	}
+
+	ctx = a.client.WithAuth(ctx)
+	archiveID := entitlement.Resource.Id.Resource
+	if a.dryRun {
+		return a.planArchiveReader(ctx, archiveID, principal.Id.Resource, true)
+	}
+
+	api := datadogV2.NewLogsArchivesApi(a.client.api)
+	isReader, err := archiveHasReadRole(ctx, api, archiveID, principal.Id.Resource)
+	if err != nil {
+		return nil, err
+	}
+	if isReader {
+		return noOpAnnotations("role can already read the logs archive")
+	}
+
+	resp, err := api.AddReadRoleToArchive(ctx, archiveID, archiveRoleRelationship(principal.Id.Resource))
+	if err != nil {
+		if hasStatus(resp, http.StatusConflict) {
+			return noOpAnnotations("role can already read the logs archive")
+		}
+		return nil, wrapError(err, resp, "baton-datadog: failed to add read role to logs archive")
+	}
+
+	return nil, nil
+}
+
+// Revoke removes the role from the read roles of the archive. Removing the last read role opens the archive
+// to every user holding the logs_read_archives permission.
+func (a *logsArchiveBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	principal := grant.Principal
+	entitlement := grant.Entitlement
+
+	if err := checkWritable(a.readOnly, "revoke logs archive read access"); err != nil {
+		return nil, err
+	}
+
+	if principal.Id.ResourceType != roleResourceType.Id {
+		return nil, status.Error(codes.InvalidArgument, "baton-datadog: only roles can have logs archive read access revoked")
+	}
+
+	ctx = a.client.WithAuth(ctx)
+	archiveID := entitlement.Resource.Id.Resource
+	if a.dryRun {
+		return a.planArchiveReader(ctx, archiveID, principal.Id.Resource, false)
+	}
+
+	api := datadogV2.NewLogsArchivesApi(a.client.api)
+	isReader, err := archiveHasReadRole(ctx, api, archiveID, principal.Id.Resource)
+	if err != nil {
+		return nil, err
+	}
+	if !isReader {
+		return noOpAnnotations("role cannot read the logs archive")
+	}
+
+	resp, err := api.RemoveRoleFromArchive(ctx, archiveID, archiveRoleRelationship(principal.Id.Resource))
+	if err != nil {
+		if hasStatus(resp, http.StatusNotFound) {
+			return noOpAnnotations("role cannot read the logs archive")
+		}
+		return nil, wrapError(err, resp, "baton-datadog: failed to remove read role from logs archive")
+	}
+
+	return nil, nil
+}
+
+// archiveHasReadRole reports whether the role is one of the read roles of the archive.
+func archiveHasReadRole(ctx context.Context, api *datadogV2.LogsArchivesApi, archiveID, roleID string) (bool, error) {
+	roles, resp, err := api.ListArchiveReadRoles(ctx, archiveID)
+	if err != nil {
+		return false, wrapError(err, resp, fmt.Sprintf("baton-datadog: failed to list read roles of logs archive %s", archiveID))
+	}
+
+	for _, role := range roles.GetData() {
+		if role.GetId() == roleID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func archiveRoleRelationship(roleID string) datadogV2.RelationshipToRole {
+	return datadogV2.RelationshipToRole{
+		Data: &datadogV2.RelationshipToRoleData{
+			Id:   datadog.PtrString(roleID),
+			Type: datadogV2.ROLESTYPE_ROLES.Ptr(),
+		},
+	}
+}
+
+func newLogsArchiveBuilder(client *client, readOnly, dryRun bool) *logsArchiveBuilder {
+	return &logsArchiveBuilder{
+		resourceType: logsArchiveResourceType,
+		client:       client,
+		readOnly:     readOnly,
+		dryRun:       dryRun,
+	}
+}
@@ -0,0 +1,149 @@
+package connector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+)
+
+// indexTTL is how long the lazily loaded indexes shared between builders are reused before being fetched again.
+const indexTTL = 10 * time.Minute
+
+// rolePermissions is a lazily loaded index of which roles hold which Datadog permissions.
+// It is shared between builders so the roles and permissions are only listed once per sync.
+type rolePermissions struct {
+	mu                sync.Mutex
+	loadedAt          time.Time
+	roleIDs           []string
+	rolesByPermission map[string][]string
+}
+
+func newRolePermissions() *rolePermissions {
+	return &rolePermissions{}
+}
+
+// RolesWithPermission returns the IDs of all roles holding the permission with the given name.
+func (r *rolePermissions) RolesWithPermission(ctx context.Context, client *client, permission string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.load(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.rolesByPermission[permission], nil
+}
+
+// Roles returns the IDs of all roles in the organization.
+func (r *rolePermissions) Roles(ctx context.Context, client *client) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.load(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.roleIDs, nil
+}
+
+func (r *rolePermissions) load(ctx context.Context, client *client) error {
+	if !r.loadedAt.IsZero() && time.Since(r.loadedAt) < indexTTL {
+		return nil
+	}
+
+	rolesApi := datadogV2.NewRolesApi(client.api)
+	permissions, resp, err := rolesApi.ListPermissions(ctx)
+	if err != nil {
+		return wrapError(err, resp, "error listing permissions")
+	}
+
+	permissionNames := make(map[string]string)
+	for _, permission := range permissions.GetData() {
+		if permission.Attributes != nil {
+			permissionNames[permission.GetId()] = permission.Attributes.GetName()
+		}
+	}
+
+	var roleIDs []string
+	rolesByPermission := make(map[string][]string)
+	for page := int64(0); ; page++ {
+		roles, resp, err := rolesApi.ListRoles(ctx, *datadogV2.NewListRolesOptionalParameters().WithPageNumber(page))
+		if err != nil {
+			return wrapError(err, resp, "error listing roles")
+		}
+
+		if len(roles.GetData()) == 0 {
+			break
+		}
+
+		for _, role := range roles.GetData() {
+			roleIDs = append(roleIDs, role.GetId())
+			if role.Relationships == nil || role.Relationships.Permissions == nil {
+				continue
+			}
+
+			for _, permission := range role.Relationships.Permissions.GetData() {
+				name, ok := permissionNames[permission.GetId()]
+				if !ok {
+					continue
+				}
+				rolesByPermission[name] = append(rolesByPermission[name], role.GetId())
+			}
+		}
+	}
+
+	r.roleIDs = roleIDs
+	r.rolesByPermission = rolesByPermission
+	r.loadedAt = time.Now()
+
+	return nil
+}
+
+// permissionRoleGrants returns grants of the entitlement to every role holding the Datadog permission,
+// expandable to the members of each role. The permission is recorded in the grant metadata.
+func permissionRoleGrants(
+	ctx context.Context,
+	client *client,
+	rolePermissions *rolePermissions,
+	resource *v2.Resource,
+	slug string,
+	permission string,
+) ([]*v2.Grant, error) {
+	roleIDs, err := rolePermissions.RolesWithPermission(ctx, client, permission)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := grant.WithGrantMetadata(map[string]interface{}{
+		"permission": permission,
+	})
+
+	rv := make([]*v2.Grant, 0, len(roleIDs))
+	for _, roleID := range roleIDs {
+		rv = append(rv, grant.NewGrant(resource, slug, roleResourceID(roleID), metadata, grant.WithAnnotation(&v2.GrantExpandable{
+			EntitlementIds: []string{roleMemberEntitlementID(roleID)},
+		})))
+	}
+
+	return rv, nil
+}
+
+// roleMemberEntitlementID returns the ID of the member entitlement of the role with the given ID.
+func roleMemberEntitlementID(roleID string) string {
+	return ent.NewEntitlementID(&v2.Resource{Id: roleResourceID(roleID)}, roleMembership)
+}
+
+// roleResourceID returns the resource ID of the role with the given ID.
+func roleResourceID(roleID string) *v2.ResourceId {
+	return &v2.ResourceId{
+		ResourceType: roleResourceType.Id,
+		Resource:     roleID,
+	}
+}
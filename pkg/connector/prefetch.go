@@ -0,0 +1,217 @@
+package connector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// pageFetcher fetches one page of the grants of a resource, and reports whether further pages may follow.
+type pageFetcher func(ctx context.Context, id string, page int64) (interface{}, bool, error)
+
+type prefetchResource struct {
+	kind string
+	id   string
+}
+
+type prefetchKey struct {
+	prefetchResource
+	page int64
+}
+
+type prefetchResult struct {
+	key     prefetchKey
+	started bool
+	done    chan struct{}
+	value   interface{}
+	more    bool
+	err     error
+}
+
+// prefetcher fetches the grant pages of teams and roles ahead of the sync with a bounded pool of workers.
+// Builders enqueue resources as they list them and Grants takes the pages back one by one. Requests made by the workers go through the rate limiter of the shared client like any other.
+// A nil prefetcher fetches every page when it is taken.
+type prefetcher struct {
+	// ctx lives as long as the connector. Workers cannot use the context of List, which is cancelled as soon as
+	// List returns when the connector runs as a service.
+	ctx     context.Context
+	workers chan struct{}
+
+	mu      sync.Mutex
+	results map[prefetchKey]*prefetchResult
+	// taking holds the resources Grants started taking pages of, the workers leave their remaining pages to Grants.
+	taking map[prefetchResource]struct{}
+	// generations count the syncs of each kind, workers of a previous sync stop once a new one starts.
+	generations map[string]int
+}
+
+// newPrefetcher returns a prefetcher running up to workers fetches at once with ctx, or nil if workers is not positive.
+func newPrefetcher(ctx context.Context, workers int) *prefetcher {
+	if workers <= 0 {
+		return nil
+	}
+
+	return &prefetcher{
+		ctx:         ctx,
+		workers:     make(chan struct{}, workers),
+		results:     make(map[prefetchKey]*prefetchResult),
+		taking:      make(map[prefetchResource]struct{}),
+		generations: make(map[string]int),
+	}
+}
+
+// Reset drops the pages of the kind left over from a previous sync, and stops the workers still fetching them.
+// Builders reset their kind when the sync starts listing it.
+func (p *prefetcher) Reset(kind string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.generations[kind]++
+	for key := range p.results {
+		if key.kind == kind {
+			delete(p.results, key)
+		}
+	}
+	for resource := range p.taking {
+		if resource.kind == kind {
+			delete(p.taking, resource)
+		}
+	}
+}
+
+// Enqueue starts fetching every page of the resources in the background, as soon as a worker is free.
+// The workers stop once the kind is reset by the next sync, or the context of the prefetcher is cancelled.
+func (p *prefetcher) Enqueue(kind string, ids []string, fetch pageFetcher) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	generation := p.generations[kind]
+	p.mu.Unlock()
+
+	for _, id := range ids {
+		go p.prefetch(p.ctx, generation, prefetchResource{kind: kind, id: id}, fetch)
+	}
+}
+
+func (p *prefetcher) prefetch(ctx context.Context, generation int, resource prefetchResource, fetch pageFetcher) {
+	select {
+	case p.workers <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	defer func() { <-p.workers }()
+
+	for page := int64(0); ; page++ {
+		result, ok := p.claim(generation, prefetchKey{prefetchResource: resource, page: page})
+		if !ok {
+			return
+		}
+
+		_, err := p.wait(ctx, result, fetch)
+		if err == nil {
+			err = result.err
+		}
+		if err != nil {
+			ctxzap.Extract(ctx).Warn(
+				"baton-datadog: prefetching grants failed, the page is fetched again when synced",
+				zap.String("kind", resource.kind),
+				zap.String("id", resource.id),
+				zap.Error(err),
+			)
+			return
+		}
+		if !result.more {
+			return
+		}
+	}
+}
+
+// claim returns the page for a worker of the generation, registering it unless it is already being fetched.
+// It reports false once the resource is no longer to be prefetched, because Grants started taking its pages
+// or a new sync started.
+func (p *prefetcher) claim(generation int, key prefetchKey) (*prefetchResult, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, taking := p.taking[key.prefetchResource]; taking || p.generations[key.kind] != generation {
+		return nil, false
+	}
+
+	return p.register(key), true
+}
+
+// register returns the page, adding it to the results if it is not there yet. The caller holds mu.
+func (p *prefetcher) register(key prefetchKey) *prefetchResult {
+	result, ok := p.results[key]
+	if !ok {
+		result = &prefetchResult{key: key, done: make(chan struct{})}
+		p.results[key] = result
+	}
+
+	return result
+}
+
+// wait fetches the page if nobody started fetching it yet, and otherwise waits for it as long as ctx allows.
+// It reports whether the page was fetched by this call.
+func (p *prefetcher) wait(ctx context.Context, result *prefetchResult, fetch pageFetcher) (bool, error) {
+	p.mu.Lock()
+	started := result.started
+	result.started = true
+	p.mu.Unlock()
+
+	if !started {
+		result.value, result.more, result.err = fetch(ctx, result.key.id, result.key.page)
+		close(result.done)
+		return true, nil
+	}
+
+	select {
+	case <-result.done:
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// Take returns a page of grants, waiting for it if it is being prefetched. Each prefetched page is handed out once
+// and then dropped, pages taken again, e.g. when the sync retries a call, are fetched anew with ctx.
+func (p *prefetcher) Take(ctx context.Context, kind, id string, page int64, fetch pageFetcher) (interface{}, error) {
+	if p == nil {
+		value, _, err := fetch(ctx, id, page)
+		return value, err
+	}
+
+	key := prefetchKey{prefetchResource: prefetchResource{kind: kind, id: id}, page: page}
+
+	p.mu.Lock()
+	p.taking[key.prefetchResource] = struct{}{}
+	result := p.register(key)
+	p.mu.Unlock()
+
+	fetched, err := p.wait(ctx, result, fetch)
+
+	p.mu.Lock()
+	if p.results[key] == result {
+		delete(p.results, key)
+	}
+	p.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	// A failed prefetch, e.g. cancelled with the context of its sync, is fetched again with ctx.
+	if result.err != nil && !fetched {
+		value, _, err := fetch(ctx, id, page)
+		return value, err
+	}
+
+	return result.value, result.err
+}
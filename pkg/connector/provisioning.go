@@ -0,0 +1,107 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const membershipPageSize = 100
+
+// noOpAnnotations returns the response of a Grant or Revoke that found the desired state already holds,
+// so retried provisioning tasks succeed instead of surfacing a Datadog conflict or not found error.
+func noOpAnnotations(reason string) (annotations.Annotations, error) {
+	md, err := structpb.NewStruct(map[string]interface{}{
+		"no_op":  true,
+		"reason": reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return annotations.New(&v2.GrantMetadata{Metadata: md}), nil
+}
+
+// hasStatus reports whether the Datadog response has one of the given HTTP status codes.
+func hasStatus(resp *http.Response, codes ...int) bool {
+	if resp == nil {
+		return false
+	}
+
+	for _, code := range codes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// userHasRole reports whether the user is a member of the role with the given ID.
+func userHasRole(user *datadogV2.User, roleID string) bool {
+	if user.Relationships == nil || user.Relationships.Roles == nil {
+		return false
+	}
+
+	for _, role := range user.Relationships.Roles.GetData() {
+		if role.GetId() == roleID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findTeamMembership returns the membership of the user in the team, or nil if the user is not a member.
+func findTeamMembership(ctx context.Context, teamsApi *datadogV2.TeamsApi, teamID, userID string) (*datadogV2.UserTeam, error) {
+	for page := int64(0); ; page++ {
+		memberships, resp, err := teamsApi.GetTeamMemberships(ctx, teamID, *datadogV2.NewGetTeamMembershipsOptionalParameters().
+			WithPageNumber(page).
+			WithPageSize(membershipPageSize))
+		if err != nil {
+			return nil, wrapError(err, resp, fmt.Sprintf("error listing memberships of team %s", teamID))
+		}
+
+		for _, membership := range memberships.GetData() {
+			if membership.Relationships == nil || membership.Relationships.User == nil {
+				continue
+			}
+			if membership.Relationships.User.GetData().Id == userID {
+				return &membership, nil
+			}
+		}
+
+		if len(memberships.GetData()) < membershipPageSize {
+			return nil, nil
+		}
+	}
+}
+
+// isTeamAdmin reports whether the team membership has the admin role.
+func isTeamAdmin(membership *datadogV2.UserTeam) bool {
+	return membership != nil && membership.HasAttributes() && membership.Attributes.GetRole() == datadogV2.USERTEAMROLE_ADMIN
+}
+
+// updateTeamMembershipRole changes the role of an existing team member, a nil role makes them a regular member.
+func updateTeamMembershipRole(ctx context.Context, teamsApi *datadogV2.TeamsApi, teamID, userID string, role *datadogV2.UserTeamRole) error {
+	body := datadogV2.UserTeamUpdateRequest{
+		Data: datadogV2.UserTeamUpdate{
+			Attributes: &datadogV2.UserTeamAttributes{
+				Role: *datadogV2.NewNullableUserTeamRole(role),
+			},
+			Type: datadogV2.USERTEAMTYPE_TEAM_MEMBERSHIPS,
+		},
+	}
+
+	_, resp, err := teamsApi.UpdateTeamMembership(ctx, teamID, userID, body)
+	if err != nil {
+		return wrapError(err, resp, fmt.Sprintf("error updating membership of user %s in team %s", userID, teamID))
+	}
+
+	return nil
+}
@@ -21,4 +21,89 @@ var (
 		DisplayName: "Team",
 		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_GROUP},
 	}
+	logsArchiveResourceType = &v2.ResourceType{
+		Id:          "logs_archive",
+		DisplayName: "Logs Archive",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	syntheticsGlobalVariableResourceType = &v2.ResourceType{
+		Id:          "synthetics_global_variable",
+		DisplayName: "Synthetics Global Variable",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	syntheticsPrivateLocationResourceType = &v2.ResourceType{
+		Id:          "synthetics_private_location",
+		DisplayName: "Synthetics Private Location",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	syntheticsTestResourceType = &v2.ResourceType{
+		Id:          "synthetics_test",
+		DisplayName: "Synthetics Test",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	serviceResourceType = &v2.ResourceType{
+		Id:          "service",
+		DisplayName: "Service",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	awsAccountResourceType = &v2.ResourceType{
+		Id:          "aws_account",
+		DisplayName: "AWS Account",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	gcpAccountResourceType = &v2.ResourceType{
+		Id:          "gcp_account",
+		DisplayName: "GCP Account",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	azureAccountResourceType = &v2.ResourceType{
+		Id:          "azure_account",
+		DisplayName: "Azure Account",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	integrationAccountResourceType = &v2.ResourceType{
+		Id:          "integration_account",
+		DisplayName: "Integration Account",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	securityMonitoringRuleResourceType = &v2.ResourceType{
+		Id:          "security_monitoring_rule",
+		DisplayName: "Security Monitoring Rule",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	securityFilterResourceType = &v2.ResourceType{
+		Id:          "security_filter",
+		DisplayName: "Security Filter",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	scannerGroupResourceType = &v2.ResourceType{
+		Id:          "sds_group",
+		DisplayName: "Sensitive Data Scanner Group",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	scannerRuleResourceType = &v2.ResourceType{
+		Id:          "sds_rule",
+		DisplayName: "Sensitive Data Scanner Rule",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	ipAllowlistResourceType = &v2.ResourceType{
+		Id:          "ip_allowlist",
+		DisplayName: "IP Allowlist",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	ipAllowlistEntryResourceType = &v2.ResourceType{
+		Id:          "ip_allowlist_entry",
+		DisplayName: "IP Allowlist Entry",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+	}
+	incidentTeamResourceType = &v2.ResourceType{
+		Id:          "incident_team",
+		DisplayName: "Incident Team",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_GROUP},
+	}
+	incidentServiceResourceType = &v2.ResourceType{
+		Id:          "incident_service",
+		DisplayName: "Incident Service",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_GROUP},
+	}
 )
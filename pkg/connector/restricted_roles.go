@@ -0,0 +1,59 @@
+package connector
+
+import (
+	"context"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+// restrictedRoleGrants returns grants of the entitlement to every role in restrictedRoles, expandable to the
+// members of each role. Datadog resources without restricted roles are open to the whole organization,
+// so they are granted to every role instead, marked as unrestricted in the grant metadata.
+func restrictedRoleGrants(
+	ctx context.Context,
+	client *client,
+	rolePermissions *rolePermissions,
+	resource *v2.Resource,
+	slug string,
+	restrictedRoles []string,
+) ([]*v2.Grant, error) {
+	roleIDs := restrictedRoles
+	if len(roleIDs) == 0 {
+		var err error
+		roleIDs, err = rolePermissions.Roles(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	metadata := grant.WithGrantMetadata(map[string]interface{}{
+		"restricted": len(restrictedRoles) != 0,
+	})
+
+	rv := make([]*v2.Grant, 0, len(roleIDs))
+	for _, roleID := range roleIDs {
+		rv = append(rv, grant.NewGrant(resource, slug, roleResourceID(roleID), metadata, grant.WithAnnotation(&v2.GrantExpandable{
+			EntitlementIds: []string{roleMemberEntitlementID(roleID)},
+		})))
+	}
+
+	return rv, nil
+}
+
+// profileRestrictedRoles returns the restricted roles recorded in the profile of the resource when it was listed,
+// so that Grants does not fetch the resource again.
+func profileRestrictedRoles(resource *v2.Resource) ([]string, error) {
+	appTrait, err := rs.GetAppTrait(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []string
+	for _, value := range appTrait.GetProfile().GetFields()["restricted_roles"].GetListValue().GetValues() {
+		rv = append(rv, value.GetStringValue())
+	}
+
+	return rv, nil
+}
@@ -3,8 +3,8 @@ package connector
 import (
 	"context"
 	"fmt"
+	"net/http"
 
-	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
@@ -14,16 +14,18 @@ import (
 	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const roleMembership = "member"
 
 type roleBuilder struct {
 	resourceType *v2.ResourceType
-	client       *datadog.APIClient
-	apiKey       string
-	appKey       string
-	site         string
+	client       *client
+	prefetcher   *prefetcher
+	readOnly     bool
+	dryRun       bool
 }
 
 func (r *roleBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
@@ -56,20 +58,25 @@ func roleResource(role *datadogV2.Role) (*v2.Resource, error) {
 
 // List returns all the roles from the database as resource objects.
 func (r *roleBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
-	ctx = withAuthContext(ctx, r.apiKey, r.appKey, r.site)
-	api := datadogV2.NewRolesApi(r.client)
+	ctx = r.client.WithAuth(ctx)
+	api := datadogV2.NewRolesApi(r.client.api)
 
 	bag, page, err := parsePageToken(pToken.Token, &v2.ResourceId{ResourceType: r.resourceType.Id})
 	if err != nil {
 		return nil, "", nil, err
 	}
+	if pToken.Token == "" {
+		// A new sync starts, the pages prefetched for the previous one are stale.
+		r.prefetcher.Reset(roleResourceType.Id)
+	}
 
-	roles, _, err := api.ListRoles(ctx, *datadogV2.NewListRolesOptionalParameters().WithPageNumber(page))
+	roles, resp, err := api.ListRoles(ctx, *datadogV2.NewListRolesOptionalParameters().WithPageNumber(page))
 	if err != nil {
-		return nil, "", nil, err
+		return nil, "", nil, wrapError(err, resp, "error listing roles")
 	}
 
 	var rv []*v2.Resource
+	var roleIDs []string
 	for _, role := range roles.GetData() {
 		roleCopy := role
 		tr, err := roleResource(&roleCopy)
@@ -77,7 +84,9 @@ func (r *roleBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId,
 			return nil, "", nil, err
 		}
 		rv = append(rv, tr)
+		roleIDs = append(roleIDs, role.GetId())
 	}
+	r.prefetcher.Enqueue(roleResourceType.Id, roleIDs, r.roleUsersPage)
 
 	nextPageToken := ""
 	if len(roles.GetData()) != 0 {
@@ -107,22 +116,26 @@ func (r *roleBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *
 	return rv, "", nil, nil
 }
 
+// Grants returns the members of the role page by page. The last page carries the ETag of all the members,
+// fingerprinted across the pages, but never an ETagMatch: listing the members of a role already returns their users,
+// so unlike teams there are no lookups to save, and a match would only have the syncer write the grants twice.
 func (r *roleBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
-	ctx = withAuthContext(ctx, r.apiKey, r.appKey, r.site)
-	rolesApi := datadogV2.NewRolesApi(r.client)
-
-	bag, page, err := parsePageToken(pToken.Token, &v2.ResourceId{ResourceType: userResourceType.Id})
+	bag, page, fp, err := parseFingerprintPageToken(pToken.Token, resource.Id)
 	if err != nil {
 		return nil, "", nil, err
 	}
 
-	users, _, err := rolesApi.ListRoleUsers(ctx, resource.Id.Resource, *datadogV2.NewListRoleUsersOptionalParameters().WithPageNumber(page))
+	value, err := r.prefetcher.Take(ctx, roleResourceType.Id, resource.Id.Resource, page, r.roleUsersPage)
 	if err != nil {
-		return nil, "", nil, fmt.Errorf("error listing users for role %s: %w", resource.DisplayName, err)
+		return nil, "", nil, err
+	}
+	users, _ := value.([]datadogV2.User)
+	if len(users) == 0 {
+		return nil, "", etagAnnotation(resource, roleMembership, fp.String()), nil
 	}
 
 	var rv []*v2.Grant
-	for _, user := range users.GetData() {
+	for _, user := range users {
 		userCopy := user
 		ur, err := userResource(&userCopy)
 		if err != nil {
@@ -130,29 +143,44 @@ func (r *roleBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken
 		}
 		gr := grant.NewGrant(resource, roleMembership, ur.Id)
 		rv = append(rv, gr)
+		fp.Add(user.GetId())
 	}
 
-	nextPageToken := ""
-	if len(users.GetData()) != 0 {
-		nextPageToken, err = getPageTokenFromPage(bag, page+1)
-		if err != nil {
-			return nil, "", nil, fmt.Errorf("datadog-connector: failed to get token from page: %w", err)
-		}
+	nextPageToken, err := getFingerprintPageToken(bag, page+1, fp)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("datadog-connector: failed to get token from page: %w", err)
 	}
 
 	return rv, nextPageToken, nil, nil
 }
 
+// roleUsersPage fetches a page of the users of a role, it is a pageFetcher for the prefetcher.
+func (r *roleBuilder) roleUsersPage(ctx context.Context, roleID string, page int64) (interface{}, bool, error) {
+	ctx = r.client.WithAuth(ctx)
+	rolesApi := datadogV2.NewRolesApi(r.client.api)
+
+	users, resp, err := rolesApi.ListRoleUsers(ctx, roleID, *datadogV2.NewListRoleUsersOptionalParameters().WithPageNumber(page))
+	if err != nil {
+		return nil, false, wrapError(err, resp, fmt.Sprintf("error listing users for role %s", roleID))
+	}
+
+	return users.GetData(), len(users.GetData()) != 0, nil
+}
+
 func (r *roleBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
 	l := ctxzap.Extract(ctx)
 
+	if err := checkWritable(r.readOnly, "grant role membership"); err != nil {
+		return nil, err
+	}
+
 	if principal.Id.ResourceType != userResourceType.Id {
 		l.Warn(
 			"baton-datadog: only users can be granted role membership",
 			zap.String("principal_type", principal.Id.ResourceType),
 			zap.String("principal_id", principal.Id.Resource),
 		)
-		return nil, fmt.Errorf("baton-datadog: only users can be granted role membership")
+		return nil, status.Error(codes.InvalidArgument, "baton-datadog: only users can be granted role membership")
 	}
 
 	body := datadogV2.RelationshipToUser{
@@ -162,11 +190,28 @@ func (r *roleBuilder) Grant(ctx context.Context, principal *v2.Resource, entitle
 		},
 	}
 
-	ctx = withAuthContext(ctx, r.apiKey, r.appKey, r.site)
-	rolesApi := datadogV2.NewRolesApi(r.client)
-	_, _, err := rolesApi.AddUserToRole(ctx, entitlement.Resource.Id.Resource, body)
+	ctx = r.client.WithAuth(ctx)
+	if r.dryRun {
+		return r.planRoleMembership(ctx, principal.Id.Resource, entitlement.Resource.Id.Resource, true)
+	}
+
+	usersApi := datadogV2.NewUsersApi(r.client.api)
+	user, resp, err := usersApi.GetUser(ctx, principal.Id.Resource)
+	if err != nil {
+		return nil, wrapError(err, resp, fmt.Sprintf("baton-datadog: failed to get user %s", principal.Id.Resource))
+	}
+	userData := user.GetData()
+	if userHasRole(&userData, entitlement.Resource.Id.Resource) {
+		return noOpAnnotations("user is already a member of the role")
+	}
+
+	rolesApi := datadogV2.NewRolesApi(r.client.api)
+	_, resp, err = rolesApi.AddUserToRole(ctx, entitlement.Resource.Id.Resource, body)
 	if err != nil {
-		return nil, fmt.Errorf("baton-datadog: failed to add user to role: %w", err)
+		if hasStatus(resp, http.StatusConflict) {
+			return noOpAnnotations("user is already a member of the role")
+		}
+		return nil, wrapError(err, resp, "baton-datadog: failed to add user to role")
 	}
 
 	return nil, nil
@@ -177,13 +222,17 @@ func (r *roleBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.
 	principal := grant.Principal
 	entitlement := grant.Entitlement
 
+	if err := checkWritable(r.readOnly, "revoke role membership"); err != nil {
+		return nil, err
+	}
+
 	if principal.Id.ResourceType != userResourceType.Id {
 		l.Warn(
 			"baton-datadog: only users can have role membership revoked",
 			zap.String("principal_type", principal.Id.ResourceType),
 			zap.String("principal_id", principal.Id.Resource),
 		)
-		return nil, fmt.Errorf("baton-datadog: only users can have role membership revoked")
+		return nil, status.Error(codes.InvalidArgument, "baton-datadog: only users can have role membership revoked")
 	}
 
 	body := datadogV2.RelationshipToUser{
@@ -193,22 +242,42 @@ func (r *roleBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.
 		},
 	}
 
-	ctx = withAuthContext(ctx, r.apiKey, r.appKey, r.site)
-	rolesApi := datadogV2.NewRolesApi(r.client)
-	_, _, err := rolesApi.RemoveUserFromRole(ctx, entitlement.Resource.Id.Resource, body)
+	ctx = r.client.WithAuth(ctx)
+	if r.dryRun {
+		return r.planRoleMembership(ctx, principal.Id.Resource, entitlement.Resource.Id.Resource, false)
+	}
+
+	usersApi := datadogV2.NewUsersApi(r.client.api)
+	user, resp, err := usersApi.GetUser(ctx, principal.Id.Resource)
 	if err != nil {
-		return nil, fmt.Errorf("baton-datadog: failed to remove user from role: %w", err)
+		if hasStatus(resp, http.StatusNotFound) {
+			return noOpAnnotations("user no longer exists")
+		}
+		return nil, wrapError(err, resp, fmt.Sprintf("baton-datadog: failed to get user %s", principal.Id.Resource))
+	}
+	userData := user.GetData()
+	if !userHasRole(&userData, entitlement.Resource.Id.Resource) {
+		return noOpAnnotations("user is not a member of the role")
+	}
+
+	rolesApi := datadogV2.NewRolesApi(r.client.api)
+	_, resp, err = rolesApi.RemoveUserFromRole(ctx, entitlement.Resource.Id.Resource, body)
+	if err != nil {
+		if hasStatus(resp, http.StatusNotFound) {
+			return noOpAnnotations("user is not a member of the role")
+		}
+		return nil, wrapError(err, resp, "baton-datadog: failed to remove user from role")
 	}
 
 	return nil, nil
 }
 
-func newRoleBuilder(client *datadog.APIClient, site, apiKey, appKey string) *roleBuilder {
+func newRoleBuilder(client *client, prefetcher *prefetcher, readOnly, dryRun bool) *roleBuilder {
 	return &roleBuilder{
 		resourceType: roleResourceType,
 		client:       client,
-		site:         site,
-		apiKey:       apiKey,
-		appKey:       appKey,
+		prefetcher:   prefetcher,
+		readOnly:     readOnly,
+		dryRun:       dryRun,
 	}
 }
@@ -0,0 +1,369 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	securityEditor    = "editor"
+	securityRuleOwner = "owner"
+
+	securityMonitoringRulesWrite   = "security_monitoring_rules_write"
+	securityMonitoringFiltersWrite = "security_monitoring_filters_write"
+
+	securityMonitoringRulesPageSize = 100
+)
+
+// securityEditorEntitlements returns the editor entitlement of a Security Monitoring resource of the given kind,
+// given by the Datadog permission.
+func securityEditorEntitlements(resource *v2.Resource, kind, permission string) []*v2.Entitlement {
+	options := []ent.EntitlementOption{
+		ent.WithGrantableTo(roleResourceType),
+		ent.WithDisplayName(fmt.Sprintf("%s %s %s", resource.DisplayName, kind, securityEditor)),
+		ent.WithDescription(fmt.Sprintf("Can change, disable or delete %s Datadog %s, given by the %s permission", resource.DisplayName, kind, permission)),
+	}
+
+	return []*v2.Entitlement{
+		ent.NewPermissionEntitlement(resource, securityEditor, options...),
+	}
+}
+
+type securityMonitoringRuleBuilder struct {
+	resourceType    *v2.ResourceType
+	client          *client
+	rolePermissions *rolePermissions
+	userIndex       *userIndex
+}
+
+func (s *securityMonitoringRuleBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return s.resourceType
+}
+
+// securityMonitoringRule holds the attributes shared by standard and signal correlation rules.
+type securityMonitoringRule struct {
+	id               string
+	name             string
+	ruleType         string
+	enabled          bool
+	isDefault        bool
+	deleted          bool
+	createdAt        int64
+	creationAuthorID int64
+	updateAuthorID   int64
+	creatorHandle    string
+	updaterHandle    string
+	version          int64
+	tags             []string
+}
+
+// securityRuleUserHandle returns the handle of the user object under the key of the additional properties of a rule.
+// The creator and updater of a rule are returned alongside the numeric author IDs, but are missing from the client models.
+func securityRuleUserHandle(additionalProperties map[string]interface{}, key string) string {
+	user, ok := additionalProperties[key].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	handle, _ := user["handle"].(string)
+
+	return handle
+}
+
+// newSecurityMonitoringRule reads the shared attributes of a rule, it returns false for rules of an unknown kind.
+func newSecurityMonitoringRule(rule *datadogV2.SecurityMonitoringRuleResponse) (securityMonitoringRule, bool) {
+	switch {
+	case rule.SecurityMonitoringStandardRuleResponse != nil:
+		r := rule.SecurityMonitoringStandardRuleResponse
+		return securityMonitoringRule{
+			id:               r.GetId(),
+			name:             r.GetName(),
+			ruleType:         string(r.GetType()),
+			enabled:          r.GetIsEnabled(),
+			isDefault:        r.GetIsDefault(),
+			deleted:          r.GetIsDeleted(),
+			createdAt:        r.GetCreatedAt(),
+			creationAuthorID: r.GetCreationAuthorId(),
+			updateAuthorID:   r.GetUpdateAuthorId(),
+			creatorHandle:    securityRuleUserHandle(r.AdditionalProperties, "creator"),
+			updaterHandle:    securityRuleUserHandle(r.AdditionalProperties, "updater"),
+			version:          r.GetVersion(),
+			tags:             r.GetTags(),
+		}, true
+	case rule.SecurityMonitoringSignalRuleResponse != nil:
+		r := rule.SecurityMonitoringSignalRuleResponse
+		return securityMonitoringRule{
+			id:               r.GetId(),
+			name:             r.GetName(),
+			ruleType:         string(r.GetType()),
+			enabled:          r.GetIsEnabled(),
+			isDefault:        r.GetIsDefault(),
+			deleted:          r.GetIsDeleted(),
+			createdAt:        r.GetCreatedAt(),
+			creationAuthorID: r.GetCreationAuthorId(),
+			updateAuthorID:   r.GetUpdateAuthorId(),
+			creatorHandle:    securityRuleUserHandle(r.AdditionalProperties, "creator"),
+			updaterHandle:    securityRuleUserHandle(r.AdditionalProperties, "updater"),
+			version:          r.GetVersion(),
+			tags:             r.GetTags(),
+		}, true
+	default:
+		return securityMonitoringRule{}, false
+	}
+}
+
+// Create a new connector resource for a Datadog Security Monitoring rule. The creator and last updater of the rule
+// are kept by handle, linked to users by the owner grant, along with the numeric author IDs Datadog reports.
+func securityMonitoringRuleResource(rule securityMonitoringRule) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"rule_id":            rule.id,
+		"rule_name":          rule.name,
+		"rule_type":          rule.ruleType,
+		"enabled":            rule.enabled,
+		"is_default":         rule.isDefault,
+		"creation_author_id": rule.creationAuthorID,
+		"update_author_id":   rule.updateAuthorID,
+		"creator_handle":     rule.creatorHandle,
+		"updater_handle":     rule.updaterHandle,
+		"version":            rule.version,
+		"tags":               stringsToInterfaces(rule.tags),
+	}
+	if rule.createdAt != 0 {
+		profile["created_at"] = time.UnixMilli(rule.createdAt).UTC().Format(time.RFC3339)
+	}
+
+	ret, err := rs.NewAppResource(
+		rule.name,
+		securityMonitoringRuleResourceType,
+		rule.id,
+		[]rs.AppTraitOption{rs.WithAppProfile(profile)},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// List returns all the Security Monitoring rules of the organization, default rules included. Deleted rules are skipped.
+func (s *securityMonitoringRuleBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ctx = s.client.WithAuth(ctx)
+	api := datadogV2.NewSecurityMonitoringApi(s.client.api)
+
+	bag, page, err := parsePageToken(pToken.Token, &v2.ResourceId{ResourceType: s.resourceType.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	rules, resp, err := api.ListSecurityMonitoringRules(ctx, *datadogV2.NewListSecurityMonitoringRulesOptionalParameters().
+		WithPageSize(securityMonitoringRulesPageSize).
+		WithPageNumber(page))
+	if err != nil {
+		// Listing rules requires the security_monitoring_rules_read permission, without it rules are skipped.
+		if hasStatus(resp, http.StatusForbidden) {
+			l.Warn("baton-datadog: not allowed to list Security Monitoring rules, skipping them", zap.Error(err))
+			return nil, "", nil, nil
+		}
+		return nil, "", nil, wrapError(err, resp, "error listing Security Monitoring rules")
+	}
+
+	var rv []*v2.Resource
+	for _, ruleResponse := range rules.GetData() {
+		ruleResponseCopy := ruleResponse
+		rule, ok := newSecurityMonitoringRule(&ruleResponseCopy)
+		if !ok {
+			l.Debug("baton-datadog: skipping Security Monitoring rule of an unknown kind")
+			continue
+		}
+		if rule.deleted {
+			continue
+		}
+
+		rr, err := securityMonitoringRuleResource(rule)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating Security Monitoring rule resource: %w", err)
+		}
+		rv = append(rv, rr)
+	}
+
+	nextPageToken := ""
+	if len(rules.GetData()) != 0 {
+		nextPageToken, err = getPageTokenFromPage(bag, page+1)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("datadog-connector: failed to get token from page: %w", err)
+		}
+	}
+
+	return rv, nextPageToken, nil, nil
+}
+
+func (s *securityMonitoringRuleBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	ownerOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(userResourceType),
+		ent.WithDisplayName(fmt.Sprintf("%s Security Monitoring rule %s", resource.DisplayName, securityRuleOwner)),
+		ent.WithDescription(fmt.Sprintf("Created %s Datadog Security Monitoring rule", resource.DisplayName)),
+	}
+
+	rv := []*v2.Entitlement{
+		ent.NewPermissionEntitlement(resource, securityRuleOwner, ownerOptions...),
+	}
+	rv = append(rv, securityEditorEntitlements(resource, "Security Monitoring rule", securityMonitoringRulesWrite)...)
+
+	return rv, "", nil, nil
+}
+
+// Grants returns the creator of the rule as its owner, and the roles holding the security_monitoring_rules_write
+// permission, expandable to the members of each role. Default rules and rules whose creator is no longer
+// a Datadog user have no owner grant.
+func (s *securityMonitoringRuleBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ctx = s.client.WithAuth(ctx)
+
+	rv, err := permissionRoleGrants(ctx, s.client, s.rolePermissions, resource, securityEditor, securityMonitoringRulesWrite)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	appTrait, err := rs.GetAppTrait(resource)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("error reading profile of Security Monitoring rule %s: %w", resource.Id.Resource, err)
+	}
+
+	creator, _ := rs.GetProfileStringValue(appTrait.Profile, "creator_handle")
+	if creator == "" {
+		authorID, _ := rs.GetProfileInt64Value(appTrait.Profile, "creation_author_id")
+		l.Debug("baton-datadog: Security Monitoring rule has no creator handle", zap.String("rule", resource.Id.Resource), zap.Int64("creation_author_id", authorID))
+		return rv, "", nil, nil
+	}
+
+	userID, ok, err := s.userIndex.UserID(ctx, s.client, creator)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if !ok {
+		l.Debug("baton-datadog: creator of Security Monitoring rule is not a Datadog user", zap.String("rule", resource.Id.Resource), zap.String("creator", creator))
+		return rv, "", nil, nil
+	}
+
+	rv = append(rv, grant.NewGrant(resource, securityRuleOwner, userResourceID(userID)))
+
+	return rv, "", nil, nil
+}
+
+func newSecurityMonitoringRuleBuilder(client *client, rolePermissions *rolePermissions, userIndex *userIndex) *securityMonitoringRuleBuilder {
+	return &securityMonitoringRuleBuilder{
+		resourceType:    securityMonitoringRuleResourceType,
+		client:          client,
+		rolePermissions: rolePermissions,
+		userIndex:       userIndex,
+	}
+}
+
+type securityFilterBuilder struct {
+	resourceType    *v2.ResourceType
+	client          *client
+	rolePermissions *rolePermissions
+}
+
+func (s *securityFilterBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return s.resourceType
+}
+
+// Create a new connector resource for a Datadog Security Monitoring security filter. Built-in filters are
+// the counterpart of default rules and are flagged as such.
+func securityFilterResource(filter *datadogV2.SecurityFilter) (*v2.Resource, error) {
+	attributes := filter.GetAttributes()
+
+	var exclusions []string
+	for _, exclusion := range attributes.GetExclusionFilters() {
+		exclusions = append(exclusions, fmt.Sprintf("%s: %s", exclusion.GetName(), exclusion.GetQuery()))
+	}
+
+	profile := map[string]interface{}{
+		"filter_id":          filter.GetId(),
+		"filter_name":        attributes.GetName(),
+		"query":              attributes.GetQuery(),
+		"filtered_data_type": string(attributes.GetFilteredDataType()),
+		"enabled":            attributes.GetIsEnabled(),
+		"is_default":         attributes.GetIsBuiltin(),
+		"exclusion_filters":  stringsToInterfaces(exclusions),
+		"version":            int64(attributes.GetVersion()),
+	}
+
+	ret, err := rs.NewAppResource(
+		attributes.GetName(),
+		securityFilterResourceType,
+		filter.GetId(),
+		[]rs.AppTraitOption{rs.WithAppProfile(profile)},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// List returns all the security filters of the organization. Security filters are not paginated.
+func (s *securityFilterBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ctx = s.client.WithAuth(ctx)
+	api := datadogV2.NewSecurityMonitoringApi(s.client.api)
+
+	filters, resp, err := api.ListSecurityFilters(ctx)
+	if err != nil {
+		// Listing security filters requires the security_monitoring_filters_read permission, without it filters are skipped.
+		if hasStatus(resp, http.StatusForbidden) {
+			l.Warn("baton-datadog: not allowed to list security filters, skipping them", zap.Error(err))
+			return nil, "", nil, nil
+		}
+		return nil, "", nil, wrapError(err, resp, "error listing security filters")
+	}
+
+	var rv []*v2.Resource
+	for _, filter := range filters.GetData() {
+		filterCopy := filter
+		fr, err := securityFilterResource(&filterCopy)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating security filter resource: %w", err)
+		}
+		rv = append(rv, fr)
+	}
+
+	return rv, "", nil, nil
+}
+
+func (s *securityFilterBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return securityEditorEntitlements(resource, "security filter", securityMonitoringFiltersWrite), "", nil, nil
+}
+
+// Grants returns the roles holding the security_monitoring_filters_write permission, expandable to the members of each role.
+func (s *securityFilterBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	ctx = s.client.WithAuth(ctx)
+
+	rv, err := permissionRoleGrants(ctx, s.client, s.rolePermissions, resource, securityEditor, securityMonitoringFiltersWrite)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return rv, "", nil, nil
+}
+
+func newSecurityFilterBuilder(client *client, rolePermissions *rolePermissions) *securityFilterBuilder {
+	return &securityFilterBuilder{
+		resourceType:    securityFilterResourceType,
+		client:          client,
+		rolePermissions: rolePermissions,
+	}
+}
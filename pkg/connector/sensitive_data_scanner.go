@@ -0,0 +1,321 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	scannerEditor = "editor"
+
+	dataScannerWrite = "data_scanner_write"
+)
+
+// scannerEditorEntitlements returns the editor entitlement of a Sensitive Data Scanner resource of the given kind.
+// Editors can disable the redaction done by the resource.
+func scannerEditorEntitlements(resource *v2.Resource, kind string) []*v2.Entitlement {
+	options := []ent.EntitlementOption{
+		ent.WithGrantableTo(roleResourceType),
+		ent.WithDisplayName(fmt.Sprintf("%s Sensitive Data Scanner %s %s", resource.DisplayName, kind, scannerEditor)),
+		ent.WithDescription(fmt.Sprintf("Can change, disable or delete %s Datadog Sensitive Data Scanner %s, given by the %s permission", resource.DisplayName, kind, dataScannerWrite)),
+	}
+
+	return []*v2.Entitlement{
+		ent.NewPermissionEntitlement(resource, scannerEditor, options...),
+	}
+}
+
+// scannerConfiguration is a lazily loaded copy of the Sensitive Data Scanner configuration. Datadog returns all
+// groups and rules at once, so it is shared between the group and rule builders and read only once per sync.
+type scannerConfiguration struct {
+	mu           sync.Mutex
+	loadedAt     time.Time
+	allowed      bool
+	groups       []datadogV2.SensitiveDataScannerGroupIncludedItem
+	rulesByGroup map[string][]datadogV2.SensitiveDataScannerRuleIncludedItem
+}
+
+func newScannerConfiguration() *scannerConfiguration {
+	return &scannerConfiguration{}
+}
+
+// Groups returns the scanning groups of the organization, ok is false when the key is not allowed to read them.
+func (s *scannerConfiguration) Groups(ctx context.Context, client *client) ([]datadogV2.SensitiveDataScannerGroupIncludedItem, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.load(ctx, client)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return s.groups, s.allowed, nil
+}
+
+// Rules returns the rules of the scanning group with the given ID, ok is false when the key is not allowed to read them.
+func (s *scannerConfiguration) Rules(ctx context.Context, client *client, groupID string) ([]datadogV2.SensitiveDataScannerRuleIncludedItem, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.load(ctx, client)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return s.rulesByGroup[groupID], s.allowed, nil
+}
+
+func (s *scannerConfiguration) load(ctx context.Context, client *client) error {
+	if !s.loadedAt.IsZero() && time.Since(s.loadedAt) < indexTTL {
+		return nil
+	}
+
+	l := ctxzap.Extract(ctx)
+	api := datadogV2.NewSensitiveDataScannerApi(client.api)
+
+	groups := []datadogV2.SensitiveDataScannerGroupIncludedItem{}
+	rulesByGroup := make(map[string][]datadogV2.SensitiveDataScannerRuleIncludedItem)
+	allowed := true
+
+	config, resp, err := api.ListScanningGroups(ctx)
+	switch {
+	// Reading the configuration requires the data_scanner_read permission, without it groups and rules are skipped.
+	case hasStatus(resp, http.StatusForbidden):
+		l.Warn("baton-datadog: not allowed to read the Sensitive Data Scanner configuration, skipping it", zap.Error(err))
+		allowed = false
+	case err != nil:
+		return wrapError(err, resp, "error reading Sensitive Data Scanner configuration")
+	default:
+		for _, included := range config.GetIncluded() {
+			switch {
+			case included.SensitiveDataScannerGroupIncludedItem != nil:
+				groups = append(groups, *included.SensitiveDataScannerGroupIncludedItem)
+			case included.SensitiveDataScannerRuleIncludedItem != nil:
+				rule := *included.SensitiveDataScannerRuleIncludedItem
+				groupID := scannerRuleGroupID(&rule)
+				rulesByGroup[groupID] = append(rulesByGroup[groupID], rule)
+			default:
+				l.Debug("baton-datadog: skipping Sensitive Data Scanner item that could not be parsed", zap.Any("item", included.UnparsedObject))
+			}
+		}
+	}
+
+	s.allowed = allowed
+	s.groups = groups
+	s.rulesByGroup = rulesByGroup
+	s.loadedAt = time.Now()
+
+	return nil
+}
+
+type scannerGroupBuilder struct {
+	resourceType    *v2.ResourceType
+	client          *client
+	rolePermissions *rolePermissions
+	configuration   *scannerConfiguration
+}
+
+func (s *scannerGroupBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return s.resourceType
+}
+
+// Create a new connector resource for a Datadog Sensitive Data Scanner group. The rules of the group are synced
+// as its children.
+func scannerGroupResource(group *datadogV2.SensitiveDataScannerGroupIncludedItem) (*v2.Resource, error) {
+	attributes := group.GetAttributes()
+
+	var products []string
+	for _, product := range attributes.GetProductList() {
+		products = append(products, string(product))
+	}
+
+	profile := map[string]interface{}{
+		"group_id":   group.GetId(),
+		"group_name": attributes.GetName(),
+		"enabled":    attributes.GetIsEnabled(),
+		"query":      attributes.Filter.GetQuery(),
+		"products":   stringsToInterfaces(products),
+	}
+
+	ret, err := rs.NewAppResource(
+		attributes.GetName(),
+		scannerGroupResourceType,
+		group.GetId(),
+		[]rs.AppTraitOption{rs.WithAppProfile(profile)},
+		rs.WithDescription(attributes.GetDescription()),
+		rs.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: scannerRuleResourceType.Id}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// List returns all the Sensitive Data Scanner groups of the organization. Groups are not paginated.
+func (s *scannerGroupBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	ctx = s.client.WithAuth(ctx)
+
+	groups, ok, err := s.configuration.Groups(ctx, s.client)
+	if err != nil || !ok {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Resource
+	for _, group := range groups {
+		groupCopy := group
+		gr, err := scannerGroupResource(&groupCopy)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating Sensitive Data Scanner group resource: %w", err)
+		}
+		rv = append(rv, gr)
+	}
+
+	return rv, "", nil, nil
+}
+
+func (s *scannerGroupBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return scannerEditorEntitlements(resource, "group"), "", nil, nil
+}
+
+// Grants returns the roles holding the data_scanner_write permission, expandable to the members of each role.
+func (s *scannerGroupBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	ctx = s.client.WithAuth(ctx)
+
+	rv, err := permissionRoleGrants(ctx, s.client, s.rolePermissions, resource, scannerEditor, dataScannerWrite)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return rv, "", nil, nil
+}
+
+func newScannerGroupBuilder(client *client, rolePermissions *rolePermissions, configuration *scannerConfiguration) *scannerGroupBuilder {
+	return &scannerGroupBuilder{
+		resourceType:    scannerGroupResourceType,
+		client:          client,
+		rolePermissions: rolePermissions,
+		configuration:   configuration,
+	}
+}
+
+type scannerRuleBuilder struct {
+	resourceType    *v2.ResourceType
+	client          *client
+	rolePermissions *rolePermissions
+	configuration   *scannerConfiguration
+}
+
+func (s *scannerRuleBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return s.resourceType
+}
+
+// Create a new connector resource for a Datadog Sensitive Data Scanner rule, a child of its group.
+func scannerRuleResource(rule *datadogV2.SensitiveDataScannerRuleIncludedItem, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	attributes := rule.GetAttributes()
+
+	profile := map[string]interface{}{
+		"rule_id":             rule.GetId(),
+		"rule_name":           attributes.GetName(),
+		"enabled":             attributes.GetIsEnabled(),
+		"pattern":             attributes.GetPattern(),
+		"standard_pattern_id": scannerRuleStandardPatternID(rule),
+		"namespaces":          stringsToInterfaces(attributes.GetNamespaces()),
+		"excluded_namespaces": stringsToInterfaces(attributes.GetExcludedNamespaces()),
+		"replacement_type":    string(attributes.TextReplacement.GetType()),
+		"tags":                stringsToInterfaces(attributes.GetTags()),
+	}
+
+	ret, err := rs.NewAppResource(
+		attributes.GetName(),
+		scannerRuleResourceType,
+		rule.GetId(),
+		[]rs.AppTraitOption{rs.WithAppProfile(profile)},
+		rs.WithDescription(attributes.GetDescription()),
+		rs.WithParentResourceID(parentResourceID),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// List returns the rules of the Sensitive Data Scanner group given as parent. Rules are only listed as children of their group.
+func (s *scannerRuleBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID == nil || parentResourceID.ResourceType != scannerGroupResourceType.Id {
+		return nil, "", nil, nil
+	}
+
+	ctx = s.client.WithAuth(ctx)
+
+	rules, ok, err := s.configuration.Rules(ctx, s.client, parentResourceID.Resource)
+	if err != nil || !ok {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Resource
+	for _, rule := range rules {
+		ruleCopy := rule
+		rr, err := scannerRuleResource(&ruleCopy, parentResourceID)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating Sensitive Data Scanner rule resource: %w", err)
+		}
+		rv = append(rv, rr)
+	}
+
+	return rv, "", nil, nil
+}
+
+// scannerRuleGroupID returns the ID of the group the rule belongs to.
+func scannerRuleGroupID(rule *datadogV2.SensitiveDataScannerRuleIncludedItem) string {
+	relationships := rule.GetRelationships()
+	group := relationships.GetGroup()
+	data := group.GetData()
+	return data.GetId()
+}
+
+// scannerRuleStandardPatternID returns the ID of the standard pattern the rule uses, or an empty string for custom patterns.
+func scannerRuleStandardPatternID(rule *datadogV2.SensitiveDataScannerRuleIncludedItem) string {
+	relationships := rule.GetRelationships()
+	pattern := relationships.GetStandardPattern()
+	data := pattern.GetData()
+	return data.GetId()
+}
+
+func (s *scannerRuleBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return scannerEditorEntitlements(resource, "rule"), "", nil, nil
+}
+
+// Grants returns the roles holding the data_scanner_write permission, expandable to the members of each role.
+func (s *scannerRuleBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	ctx = s.client.WithAuth(ctx)
+
+	rv, err := permissionRoleGrants(ctx, s.client, s.rolePermissions, resource, scannerEditor, dataScannerWrite)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return rv, "", nil, nil
+}
+
+func newScannerRuleBuilder(client *client, rolePermissions *rolePermissions, configuration *scannerConfiguration) *scannerRuleBuilder {
+	return &scannerRuleBuilder{
+		resourceType:    scannerRuleResourceType,
+		client:          client,
+		rolePermissions: rolePermissions,
+		configuration:   configuration,
+	}
+}
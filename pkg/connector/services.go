@@ -0,0 +1,184 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	serviceOwner = "owner"
+
+	servicesPageSize = 100
+)
+
+type serviceBuilder struct {
+	resourceType *v2.ResourceType
+	client       *client
+	teamIndex    *teamIndex
+}
+
+func (s *serviceBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return s.resourceType
+}
+
+// Create a new connector resource for a service of the Datadog Service Catalog.
+func serviceResource(definition *datadogV2.ServiceDefinitionV2Dot2) (*v2.Resource, error) {
+	var contacts []string
+	for _, contact := range definition.GetContacts() {
+		contacts = append(contacts, fmt.Sprintf("%s:%s", contact.GetType(), contact.GetContact()))
+	}
+
+	var onCall []string
+	if definition.Integrations != nil {
+		if url := definition.Integrations.Pagerduty.GetServiceUrl(); url != "" {
+			onCall = append(onCall, url)
+		}
+		if url := definition.Integrations.Opsgenie.GetServiceUrl(); url != "" {
+			onCall = append(onCall, url)
+		}
+	}
+
+	profile := map[string]interface{}{
+		"service_name": definition.GetDdService(),
+		"team":         definition.GetTeam(),
+		"application":  definition.GetApplication(),
+		"tier":         definition.GetTier(),
+		"lifecycle":    definition.GetLifecycle(),
+		"languages":    stringsToInterfaces(definition.GetLanguages()),
+		"contacts":     stringsToInterfaces(contacts),
+		"on_call":      stringsToInterfaces(onCall),
+	}
+
+	serviceTraitOptions := []rs.AppTraitOption{
+		rs.WithAppProfile(profile),
+	}
+
+	ret, err := rs.NewAppResource(
+		definition.GetDdService(),
+		serviceResourceType,
+		definition.GetDdService(),
+		serviceTraitOptions,
+		rs.WithDescription(definition.GetDescription()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// List returns all the services of the Service Catalog as resource objects. The definitions are requested
+// in the v2.2 schema, Datadog converts the definitions written in older schemas.
+func (s *serviceBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ctx = s.client.WithAuth(ctx)
+	api := datadogV2.NewServiceDefinitionApi(s.client.api)
+
+	bag, page, err := parsePageToken(pToken.Token, &v2.ResourceId{ResourceType: s.resourceType.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	definitions, resp, err := api.ListServiceDefinitions(ctx, *datadogV2.NewListServiceDefinitionsOptionalParameters().
+		WithPageSize(servicesPageSize).
+		WithPageNumber(page).
+		WithSchemaVersion(datadogV2.SERVICEDEFINITIONSCHEMAVERSIONS_V2_2))
+	if err != nil {
+		// Listing services requires the apm_service_catalog_read permission, without it services are skipped.
+		if hasStatus(resp, http.StatusForbidden) {
+			l.Warn("baton-datadog: not allowed to list Service Catalog services, skipping them", zap.Error(err))
+			return nil, "", nil, nil
+		}
+		return nil, "", nil, wrapError(err, resp, "error listing service definitions")
+	}
+
+	var rv []*v2.Resource
+	for _, data := range definitions.GetData() {
+		schema := data.Attributes.GetSchema()
+		if schema.ServiceDefinitionV2Dot2 == nil {
+			l.Debug("baton-datadog: skipping service definition not in the v2.2 schema", zap.String("id", data.GetId()))
+			continue
+		}
+
+		sr, err := serviceResource(schema.ServiceDefinitionV2Dot2)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating service resource: %w", err)
+		}
+		rv = append(rv, sr)
+	}
+
+	nextPageToken := ""
+	if len(definitions.GetData()) != 0 {
+		nextPageToken, err = getPageTokenFromPage(bag, page+1)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("datadog-connector: failed to get token from page: %w", err)
+		}
+	}
+
+	return rv, nextPageToken, nil, nil
+}
+
+func (s *serviceBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	ownerOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(teamResourceType),
+		ent.WithDisplayName(fmt.Sprintf("%s Service %s", resource.DisplayName, serviceOwner)),
+		ent.WithDescription(fmt.Sprintf("Owns %s service in the Datadog Service Catalog", resource.DisplayName)),
+	}
+
+	return []*v2.Entitlement{
+		ent.NewPermissionEntitlement(resource, serviceOwner, ownerOptions...),
+	}, "", nil, nil
+}
+
+// Grants returns the team owning the service, expandable to the members of the team. Services owned by
+// a handle that matches no Datadog team have no grants.
+func (s *serviceBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ctx = s.client.WithAuth(ctx)
+
+	appTrait, err := rs.GetAppTrait(resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	teamHandle, ok := rs.GetProfileStringValue(appTrait.Profile, "team")
+	if !ok || teamHandle == "" {
+		return nil, "", nil, nil
+	}
+
+	teamID, ok, err := s.teamIndex.TeamID(ctx, s.client, teamHandle)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if !ok {
+		l.Debug("baton-datadog: owner of service is not a Datadog team", zap.String("service", resource.Id.Resource), zap.String("team", teamHandle))
+		return nil, "", nil, nil
+	}
+
+	rv := []*v2.Grant{
+		grant.NewGrant(resource, serviceOwner, teamResourceID(teamID), grant.WithAnnotation(&v2.GrantExpandable{
+			EntitlementIds: []string{teamMemberEntitlementID(teamID)},
+		})),
+	}
+
+	return rv, "", nil, nil
+}
+
+func newServiceBuilder(client *client, teamIndex *teamIndex) *serviceBuilder {
+	return &serviceBuilder{
+		resourceType: serviceResourceType,
+		client:       client,
+		teamIndex:    teamIndex,
+	}
+}
@@ -0,0 +1,63 @@
+package connector
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+)
+
+// datadogSites are the Datadog regions and the site each one is served from.
+var datadogSites = []struct {
+	Region string
+	Site   string
+}{
+	{Region: "US1", Site: "datadoghq.com"},
+	{Region: "US3", Site: "us3.datadoghq.com"},
+	{Region: "US5", Site: "us5.datadoghq.com"},
+	{Region: "EU", Site: "datadoghq.eu"},
+	{Region: "AP1", Site: "ap1.datadoghq.com"},
+	{Region: "Gov", Site: "ddog-gov.com"},
+}
+
+// ValidateSite returns an error if the site is not one of the known Datadog regions.
+func ValidateSite(site string) error {
+	known := make([]string, 0, len(datadogSites))
+	for _, s := range datadogSites {
+		if s.Site == site {
+			return nil
+		}
+		known = append(known, fmt.Sprintf("%s (%s)", s.Site, s.Region))
+	}
+
+	return fmt.Errorf("baton-datadog: unknown site %q, expected one of %s, or set a base URL", site, strings.Join(known, ", "))
+}
+
+// configureServer points the API client at the Datadog site, or at the base URL when one is given.
+// A base URL replaces the server configuration entirely, including scheme, port and any path prefix,
+// so the connector can go through a proxy or talk to a local stand-in for Datadog.
+func configureServer(conf *datadog.Configuration, site, baseURL string) error {
+	if baseURL == "" {
+		return ValidateSite(site)
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("baton-datadog: invalid base URL %q: %w", baseURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("baton-datadog: invalid base URL %q, expected an absolute http or https URL", baseURL)
+	}
+
+	conf.Servers = datadog.ServerConfigurations{
+		{
+			URL:         strings.TrimSuffix(baseURL, "/"),
+			Description: "Base URL override",
+		},
+	}
+	// Some operations are served from their own hosts, the override applies to them as well.
+	conf.OperationServers = map[string]datadog.ServerConfigurations{}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	syntheticsEditor = "editor"
+
+	// privateLocationPrefix marks the IDs of private locations among the Synthetics locations.
+	privateLocationPrefix = "pl:"
+)
+
+// syntheticsEditorEntitlements returns the editor entitlement of a Synthetics resource of the given kind.
+func syntheticsEditorEntitlements(resource *v2.Resource, kind string) []*v2.Entitlement {
+	options := []ent.EntitlementOption{
+		ent.WithGrantableTo(roleResourceType),
+		ent.WithDisplayName(fmt.Sprintf("%s Synthetics %s %s", resource.DisplayName, kind, syntheticsEditor)),
+		ent.WithDescription(fmt.Sprintf("Can read and change %s Datadog Synthetics %s", resource.DisplayName, kind)),
+	}
+
+	return []*v2.Entitlement{
+		ent.NewPermissionEntitlement(resource, syntheticsEditor, options...),
+	}
+}
+
+type syntheticsGlobalVariableBuilder struct {
+	resourceType    *v2.ResourceType
+	client          *client
+	rolePermissions *rolePermissions
+}
+
+func (s *syntheticsGlobalVariableBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return s.resourceType
+}
+
+// Create a new connector resource for a Datadog Synthetics global variable.
+// Secure variables are called out in the description, the value of a variable is never synced.
+func syntheticsGlobalVariableResource(variable *datadogV1.SyntheticsGlobalVariable) (*v2.Resource, error) {
+	description := variable.GetDescription()
+	if variable.Value.GetSecure() {
+		description = strings.TrimSpace("Secure variable. " + description)
+	}
+
+	profile := map[string]interface{}{
+		"secure":           variable.Value.GetSecure(),
+		"restricted_roles": stringsToInterfaces(variable.Attributes.GetRestrictedRoles()),
+	}
+
+	ret, err := rs.NewAppResource(
+		variable.GetName(),
+		syntheticsGlobalVariableResourceType,
+		variable.GetId(),
+		[]rs.AppTraitOption{rs.WithAppProfile(profile)},
+		rs.WithDescription(description),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// List returns all the Synthetics global variables of the organization. Global variables are not paginated.
+func (s *syntheticsGlobalVariableBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ctx = s.client.WithAuth(ctx)
+	api := datadogV1.NewSyntheticsApi(s.client.api)
+
+	variables, resp, err := api.ListGlobalVariables(ctx)
+	if err != nil {
+		// Listing global variables requires the synthetics_global_variable_read permission, without it they are skipped.
+		if hasStatus(resp, http.StatusForbidden) {
+			l.Warn("baton-datadog: not allowed to list Synthetics global variables, skipping them", zap.Error(err))
+			return nil, "", nil, nil
+		}
+		return nil, "", nil, wrapError(err, resp, "error listing Synthetics global variables")
+	}
+
+	var rv []*v2.Resource
+	for _, variable := range variables.GetVariables() {
+		variableCopy := variable
+		vr, err := syntheticsGlobalVariableResource(&variableCopy)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating Synthetics global variable resource: %w", err)
+		}
+		rv = append(rv, vr)
+	}
+
+	return rv, "", nil, nil
+}
+
+func (s *syntheticsGlobalVariableBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return syntheticsEditorEntitlements(resource, "global variable"), "", nil, nil
+}
+
+// Grants returns the roles the global variable is restricted to, or every role if it is not restricted.
+// The restricted roles are read from the profile of the variable.
+func (s *syntheticsGlobalVariableBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	ctx = s.client.WithAuth(ctx)
+
+	restrictedRoles, err := profileRestrictedRoles(resource)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("error reading restricted roles of Synthetics global variable %s: %w", resource.Id.Resource, err)
+	}
+
+	rv, err := restrictedRoleGrants(ctx, s.client, s.rolePermissions, resource, syntheticsEditor, restrictedRoles)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return rv, "", nil, nil
+}
+
+func newSyntheticsGlobalVariableBuilder(client *client, rolePermissions *rolePermissions) *syntheticsGlobalVariableBuilder {
+	return &syntheticsGlobalVariableBuilder{
+		resourceType:    syntheticsGlobalVariableResourceType,
+		client:          client,
+		rolePermissions: rolePermissions,
+	}
+}
+
+type syntheticsPrivateLocationBuilder struct {
+	resourceType    *v2.ResourceType
+	client          *client
+	rolePermissions *rolePermissions
+}
+
+func (s *syntheticsPrivateLocationBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return s.resourceType
+}
+
+// Create a new connector resource for a Datadog Synthetics private location.
+func syntheticsPrivateLocationResource(location *datadogV1.SyntheticsPrivateLocation) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"restricted_roles": stringsToInterfaces(location.Metadata.GetRestrictedRoles()),
+	}
+
+	ret, err := rs.NewAppResource(
+		location.GetName(),
+		syntheticsPrivateLocationResourceType,
+		location.GetId(),
+		[]rs.AppTraitOption{rs.WithAppProfile(profile)},
+		rs.WithDescription(location.GetDescription()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// List returns all the Synthetics private locations of the organization. Datadog only lists private locations
+// alongside the managed ones, so each private location is fetched on its own for its details.
+func (s *syntheticsPrivateLocationBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ctx = s.client.WithAuth(ctx)
+	api := datadogV1.NewSyntheticsApi(s.client.api)
+
+	locations, resp, err := api.ListLocations(ctx)
+	if err != nil {
+		if hasStatus(resp, http.StatusForbidden) {
+			l.Warn("baton-datadog: not allowed to list Synthetics locations, skipping private locations", zap.Error(err))
+			return nil, "", nil, nil
+		}
+		return nil, "", nil, wrapError(err, resp, "error listing Synthetics locations")
+	}
+
+	var rv []*v2.Resource
+	for _, location := range locations.GetLocations() {
+		if !strings.HasPrefix(location.GetId(), privateLocationPrefix) {
+			continue
+		}
+
+		privateLocation, resp, err := api.GetPrivateLocation(ctx, location.GetId())
+		if err != nil {
+			return nil, "", nil, wrapError(err, resp, fmt.Sprintf("error getting Synthetics private location %s", location.GetId()))
+		}
+		// Keep the listed ID in case the details omit it.
+		privateLocation.SetId(location.GetId())
+
+		lr, err := syntheticsPrivateLocationResource(&privateLocation)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating Synthetics private location resource: %w", err)
+		}
+		rv = append(rv, lr)
+	}
+
+	return rv, "", nil, nil
+}
+
+func (s *syntheticsPrivateLocationBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return syntheticsEditorEntitlements(resource, "private location"), "", nil, nil
+}
+
+// Grants returns the roles the private location is restricted to, or every role if it is not restricted.
+// The restricted roles are read from the profile of the location.
+func (s *syntheticsPrivateLocationBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	ctx = s.client.WithAuth(ctx)
+
+	restrictedRoles, err := profileRestrictedRoles(resource)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("error reading restricted roles of Synthetics private location %s: %w", resource.Id.Resource, err)
+	}
+
+	rv, err := restrictedRoleGrants(ctx, s.client, s.rolePermissions, resource, syntheticsEditor, restrictedRoles)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return rv, "", nil, nil
+}
+
+func newSyntheticsPrivateLocationBuilder(client *client, rolePermissions *rolePermissions) *syntheticsPrivateLocationBuilder {
+	return &syntheticsPrivateLocationBuilder{
+		resourceType:    syntheticsPrivateLocationResourceType,
+		client:          client,
+		rolePermissions: rolePermissions,
+	}
+}
@@ -0,0 +1,178 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	syntheticsTestOwner = "owner"
+
+	syntheticsTestsPageSize = 100
+)
+
+type syntheticsTestBuilder struct {
+	resourceType    *v2.ResourceType
+	client          *client
+	rolePermissions *rolePermissions
+	userIndex       *userIndex
+}
+
+func (s *syntheticsTestBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return s.resourceType
+}
+
+// Create a new connector resource for a Datadog Synthetics test.
+func syntheticsTestResource(test *datadogV1.SyntheticsTestDetails) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"test_public_id":   test.GetPublicId(),
+		"test_name":        test.GetName(),
+		"test_type":        string(test.GetType()),
+		"test_subtype":     string(test.GetSubtype()),
+		"status":           string(test.GetStatus()),
+		"locations":        stringsToInterfaces(test.GetLocations()),
+		"monitor_id":       test.GetMonitorId(),
+		"creator_handle":   test.Creator.GetHandle(),
+		"creator_email":    test.Creator.GetEmail(),
+		"restricted_roles": stringsToInterfaces(test.Options.GetRestrictedRoles()),
+	}
+
+	testTraitOptions := []rs.AppTraitOption{
+		rs.WithAppProfile(profile),
+	}
+
+	ret, err := rs.NewAppResource(
+		test.GetName(),
+		syntheticsTestResourceType,
+		test.GetPublicId(),
+		testTraitOptions,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// List returns all the Synthetics tests of the organization as resource objects.
+func (s *syntheticsTestBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ctx = s.client.WithAuth(ctx)
+	api := datadogV1.NewSyntheticsApi(s.client.api)
+
+	bag, page, err := parsePageToken(pToken.Token, &v2.ResourceId{ResourceType: s.resourceType.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	tests, resp, err := api.ListTests(ctx, *datadogV1.NewListTestsOptionalParameters().
+		WithPageSize(syntheticsTestsPageSize).
+		WithPageNumber(page))
+	if err != nil {
+		// Listing tests requires the synthetics_read permission, without it tests are skipped.
+		if hasStatus(resp, http.StatusForbidden) {
+			l.Warn("baton-datadog: not allowed to list Synthetics tests, skipping them", zap.Error(err))
+			return nil, "", nil, nil
+		}
+		return nil, "", nil, wrapError(err, resp, "error listing Synthetics tests")
+	}
+
+	var rv []*v2.Resource
+	for _, test := range tests.GetTests() {
+		testCopy := test
+		tr, err := syntheticsTestResource(&testCopy)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error creating Synthetics test resource: %w", err)
+		}
+		rv = append(rv, tr)
+	}
+
+	nextPageToken := ""
+	if len(tests.GetTests()) != 0 {
+		nextPageToken, err = getPageTokenFromPage(bag, page+1)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("datadog-connector: failed to get token from page: %w", err)
+		}
+	}
+
+	return rv, nextPageToken, nil, nil
+}
+
+func (s *syntheticsTestBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	ownerOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(userResourceType),
+		ent.WithDisplayName(fmt.Sprintf("%s Synthetics test %s", resource.DisplayName, syntheticsTestOwner)),
+		ent.WithDescription(fmt.Sprintf("Created %s Datadog Synthetics test", resource.DisplayName)),
+	}
+
+	rv := []*v2.Entitlement{
+		ent.NewPermissionEntitlement(resource, syntheticsTestOwner, ownerOptions...),
+	}
+	rv = append(rv, syntheticsEditorEntitlements(resource, "test")...)
+
+	return rv, "", nil, nil
+}
+
+// Grants returns the creator of the test as its owner, and the roles the test is restricted to as its editors,
+// or every role if it is not restricted. Both are read from the profile of the test. Creators who are no longer
+// Datadog users have no owner grant.
+func (s *syntheticsTestBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ctx = s.client.WithAuth(ctx)
+
+	appTrait, err := rs.GetAppTrait(resource)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("error reading profile of Synthetics test %s: %w", resource.Id.Resource, err)
+	}
+	restrictedRoles, err := profileRestrictedRoles(resource)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("error reading restricted roles of Synthetics test %s: %w", resource.Id.Resource, err)
+	}
+
+	rv, err := restrictedRoleGrants(ctx, s.client, s.rolePermissions, resource, syntheticsEditor, restrictedRoles)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	creator, _ := rs.GetProfileStringValue(appTrait.Profile, "creator_handle")
+	if creator == "" {
+		creator, _ = rs.GetProfileStringValue(appTrait.Profile, "creator_email")
+	}
+	if creator == "" {
+		l.Debug("baton-datadog: Synthetics test has no creator", zap.String("test", resource.Id.Resource))
+		return rv, "", nil, nil
+	}
+
+	userID, ok, err := s.userIndex.UserID(ctx, s.client, creator)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if !ok {
+		l.Debug("baton-datadog: creator of Synthetics test is not a Datadog user", zap.String("test", resource.Id.Resource), zap.String("creator", creator))
+		return rv, "", nil, nil
+	}
+
+	rv = append(rv, grant.NewGrant(resource, syntheticsTestOwner, userResourceID(userID)))
+
+	return rv, "", nil, nil
+}
+
+func newSyntheticsTestBuilder(client *client, rolePermissions *rolePermissions, userIndex *userIndex) *syntheticsTestBuilder {
+	return &syntheticsTestBuilder{
+		resourceType:    syntheticsTestResourceType,
+		client:          client,
+		rolePermissions: rolePermissions,
+		userIndex:       userIndex,
+	}
+}
@@ -0,0 +1,103 @@
+package connector
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+)
+
+// teamIndex is a lazily loaded index of team IDs by handle and name. Datadog references the teams owning services
+// and other resources by handle only, the index resolves them to the synced teams. Incident teams and services
+// are not linked to teams at all, they are matched to the teams of the same name.
+type teamIndex struct {
+	mu       sync.Mutex
+	loadedAt time.Time
+	byHandle map[string]string
+	byName   map[string]string
+}
+
+func newTeamIndex() *teamIndex {
+	return &teamIndex{}
+}
+
+// TeamID returns the ID of the team with the given handle, compared case-insensitively.
+func (t *teamIndex) TeamID(ctx context.Context, client *client, handle string) (string, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.load(ctx, client)
+	if err != nil {
+		return "", false, err
+	}
+
+	id, ok := t.byHandle[strings.ToLower(handle)]
+	return id, ok, nil
+}
+
+// TeamIDByName returns the ID of the team with the given name, compared case-insensitively.
+func (t *teamIndex) TeamIDByName(ctx context.Context, client *client, name string) (string, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.load(ctx, client)
+	if err != nil {
+		return "", false, err
+	}
+
+	id, ok := t.byName[strings.ToLower(name)]
+	return id, ok, nil
+}
+
+func (t *teamIndex) load(ctx context.Context, client *client) error {
+	if !t.loadedAt.IsZero() && time.Since(t.loadedAt) < indexTTL {
+		return nil
+	}
+
+	api := datadogV2.NewTeamsApi(client.api)
+
+	byHandle := make(map[string]string)
+	byName := make(map[string]string)
+	for page := int64(0); ; page++ {
+		teams, resp, err := api.ListTeams(ctx, *datadogV2.NewListTeamsOptionalParameters().WithPageNumber(page))
+		if err != nil {
+			return wrapError(err, resp, "error listing teams")
+		}
+
+		if len(teams.GetData()) == 0 {
+			break
+		}
+
+		for _, team := range teams.GetData() {
+			if team.Attributes.GetHandle() != "" {
+				byHandle[strings.ToLower(team.Attributes.GetHandle())] = team.GetId()
+			}
+			if team.Attributes.GetName() != "" {
+				byName[strings.ToLower(team.Attributes.GetName())] = team.GetId()
+			}
+		}
+	}
+
+	t.byHandle = byHandle
+	t.byName = byName
+	t.loadedAt = time.Now()
+
+	return nil
+}
+
+// teamMemberEntitlementID returns the ID of the member entitlement of the team with the given ID.
+func teamMemberEntitlementID(teamID string) string {
+	return ent.NewEntitlementID(&v2.Resource{Id: teamResourceID(teamID)}, memberRole)
+}
+
+// teamResourceID returns the resource ID of the team with the given ID.
+func teamResourceID(teamID string) *v2.ResourceId {
+	return &v2.ResourceId{
+		ResourceType: teamResourceType.Id,
+		Resource:     teamID,
+	}
+}
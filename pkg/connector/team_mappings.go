@@ -0,0 +1,136 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// teamMappingSource describes a SAML mapping that provisions members into a team.
+type teamMappingSource struct {
+	MappingID      string
+	AttributeKey   string
+	AttributeValue string
+}
+
+func (s teamMappingSource) String() string {
+	return fmt.Sprintf("%s=%s", s.AttributeKey, s.AttributeValue)
+}
+
+// teamMappings is a lazily loaded index of the SAML mappings that manage team memberships.
+// Datadog overwrites the memberships of these teams on every SAML login, so they must not be provisioned by Baton.
+type teamMappings struct {
+	mu       sync.Mutex
+	loadedAt time.Time
+	byTeam   map[string][]teamMappingSource
+}
+
+func newTeamMappings() *teamMappings {
+	return &teamMappings{}
+}
+
+// ForTeam returns the SAML mappings managing the membership of the team with the given ID.
+func (m *teamMappings) ForTeam(ctx context.Context, client *client, teamID string) ([]teamMappingSource, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := m.load(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.byTeam[teamID], nil
+}
+
+func (m *teamMappings) load(ctx context.Context, client *client) error {
+	if !m.loadedAt.IsZero() && time.Since(m.loadedAt) < indexTTL {
+		return nil
+	}
+
+	l := ctxzap.Extract(ctx)
+	api := datadogV2.NewAuthNMappingsApi(client.api)
+
+	byTeam := make(map[string][]teamMappingSource)
+	for page := int64(0); ; page++ {
+		mappings, resp, err := api.ListAuthNMappings(ctx, *datadogV2.NewListAuthNMappingsOptionalParameters().WithPageNumber(page))
+		if err != nil {
+			// Reading mappings requires the user_access_manage scope, without it teams are treated as not IdP managed.
+			if hasStatus(resp, http.StatusForbidden) {
+				l.Warn("baton-datadog: not allowed to list SAML mappings, team memberships are assumed not to be IdP managed", zap.Error(err))
+				break
+			}
+			return wrapError(err, resp, "error listing SAML mappings")
+		}
+
+		if len(mappings.GetData()) == 0 {
+			break
+		}
+
+		for _, mapping := range mappings.GetData() {
+			teamID := mappingTeamID(mapping)
+			if teamID == "" {
+				continue
+			}
+
+			byTeam[teamID] = append(byTeam[teamID], teamMappingSource{
+				MappingID:      mapping.GetId(),
+				AttributeKey:   mapping.Attributes.GetAttributeKey(),
+				AttributeValue: mapping.Attributes.GetAttributeValue(),
+			})
+		}
+	}
+
+	m.byTeam = byTeam
+	m.loadedAt = time.Now()
+
+	return nil
+}
+
+// mappingTeamID returns the ID of the team a SAML mapping provisions members into, or an empty string
+// for mappings assigning roles. The client does not model team mappings yet, so the relationship is read
+// from the additional properties of the response.
+func mappingTeamID(mapping datadogV2.AuthNMapping) string {
+	if mapping.Relationships == nil {
+		return ""
+	}
+
+	team, ok := mapping.Relationships.AdditionalProperties["team"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	data, ok := team["data"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	id, _ := data["id"].(string)
+	return id
+}
+
+// mappingSourcesString joins the mapping sources into a human readable list.
+func mappingSourcesString(sources []teamMappingSource) string {
+	rv := make([]string, 0, len(sources))
+	for _, source := range sources {
+		rv = append(rv, source.String())
+	}
+
+	return strings.Join(rv, ", ")
+}
+
+// appURL returns the URL of the Datadog web application for the given site.
+// Sites other than US1, EU and Gov already carry their own subdomain, e.g. us3.datadoghq.com.
+func appURL(site string) string {
+	if strings.Count(site, ".") > 1 {
+		return "https://" + site
+	}
+
+	return "https://app." + site
+}
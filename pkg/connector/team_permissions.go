@@ -0,0 +1,178 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultTeamPermissionValue is the value Datadog assigns to team permission settings by default.
+// Revoking a permission setting entitlement resets the setting back to it.
+var defaultTeamPermissionValue = datadogV2.TEAMPERMISSIONSETTINGVALUE_ADMINS
+
+var teamPermissionActions = []datadogV2.TeamPermissionSettingSerializerAction{
+	datadogV2.TEAMPERMISSIONSETTINGSERIALIZERACTION_MANAGE_MEMBERSHIP,
+	datadogV2.TEAMPERMISSIONSETTINGSERIALIZERACTION_EDIT,
+}
+
+// teamPermissionSlug returns the entitlement slug for a team permission setting action set to a value,
+// e.g. manage_membership_organization.
+func teamPermissionSlug(action datadogV2.TeamPermissionSettingSerializerAction, value datadogV2.TeamPermissionSettingValue) string {
+	return fmt.Sprintf("%s_%s", action, value)
+}
+
+// parseTeamPermissionSlug splits a team permission setting entitlement slug into its action and value.
+// It returns false if the slug does not belong to a team permission setting.
+func parseTeamPermissionSlug(slug string) (datadogV2.TeamPermissionSettingSerializerAction, datadogV2.TeamPermissionSettingValue, bool) {
+	for _, action := range teamPermissionActions {
+		prefix := string(action) + "_"
+		if !strings.HasPrefix(slug, prefix) {
+			continue
+		}
+
+		value, err := datadogV2.NewTeamPermissionSettingValueFromValue(strings.TrimPrefix(slug, prefix))
+		if err != nil {
+			return "", "", false
+		}
+
+		return action, *value, true
+	}
+
+	return "", "", false
+}
+
+// teamPermissionEntitlements returns an entitlement for every option of every permission setting of the team.
+func teamPermissionEntitlements(resource *v2.Resource, settings []datadogV2.TeamPermissionSetting) []*v2.Entitlement {
+	var rv []*v2.Entitlement
+	for _, setting := range settings {
+		if setting.Attributes == nil {
+			continue
+		}
+
+		action := setting.Attributes.GetAction()
+		for _, value := range setting.Attributes.GetOptions() {
+			options := []ent.EntitlementOption{
+				ent.WithGrantableTo(teamResourceType),
+				ent.WithDisplayName(fmt.Sprintf("%s Team %s: %s", resource.DisplayName, setting.Attributes.GetTitle(), value)),
+				ent.WithDescription(fmt.Sprintf("%s permission of %s Datadog team is granted to %s", action, resource.DisplayName, value)),
+			}
+			rv = append(rv, ent.NewPermissionEntitlement(resource, teamPermissionSlug(action, value), options...))
+		}
+	}
+
+	return rv
+}
+
+// permissionSettingGrants returns a grant to the team for the current value of every permission setting of the team.
+// Each grant is expandable to the users the setting effectively applies to: the admins or members of the team,
+// the members of the roles holding the referenced Datadog permission, or the members of every role
+// when the whole organization is allowed.
+func (t *teamBuilder) permissionSettingGrants(ctx context.Context, resource *v2.Resource, settings []datadogV2.TeamPermissionSetting) ([]*v2.Grant, error) {
+	var rv []*v2.Grant
+	for _, setting := range settings {
+		if setting.Attributes == nil || !setting.Attributes.HasValue() {
+			continue
+		}
+
+		action := setting.Attributes.GetAction()
+		value := setting.Attributes.GetValue()
+		slug := teamPermissionSlug(action, value)
+		options := []grant.GrantOption{
+			grant.WithGrantMetadata(map[string]interface{}{
+				"action":   string(action),
+				"value":    string(value),
+				"editable": setting.Attributes.GetEditable(),
+			}),
+		}
+
+		var expandTo []string
+		switch value {
+		case datadogV2.TEAMPERMISSIONSETTINGVALUE_ADMINS:
+			expandTo = []string{ent.NewEntitlementID(resource, adminRole)}
+		case datadogV2.TEAMPERMISSIONSETTINGVALUE_MEMBERS:
+			expandTo = []string{ent.NewEntitlementID(resource, memberRole)}
+		default:
+			var roleIDs []string
+			var err error
+			if value == datadogV2.TEAMPERMISSIONSETTINGVALUE_ORGANIZATION {
+				roleIDs, err = t.rolePermissions.Roles(ctx, t.client)
+			} else {
+				// The remaining values name the Datadog permission a role must hold.
+				roleIDs, err = t.rolePermissions.RolesWithPermission(ctx, t.client, string(value))
+			}
+			if err != nil {
+				return nil, err
+			}
+			for _, roleID := range roleIDs {
+				expandTo = append(expandTo, roleMemberEntitlementID(roleID))
+			}
+		}
+		if len(expandTo) != 0 {
+			options = append(options, grant.WithAnnotation(&v2.GrantExpandable{EntitlementIds: expandTo}))
+		}
+
+		rv = append(rv, grant.NewGrant(resource, slug, resource.Id, options...))
+	}
+
+	return rv, nil
+}
+
+// isPermissionSettingPrincipal reports whether the principal can hold a permission setting entitlement, that is
+// the team the setting belongs to. A setting holds a single value for the whole team, so it cannot be granted
+// to or revoked from a single role, roles are only reached by expanding the grant to the team.
+func isPermissionSettingPrincipal(principal *v2.Resource, entitlement *v2.Entitlement) bool {
+	return principal.Id.ResourceType == teamResourceType.Id && principal.Id.Resource == entitlement.Resource.Id.Resource
+}
+
+// getTeamPermissionSetting returns the current value of the permission setting action of the team.
+func getTeamPermissionSetting(
+	ctx context.Context,
+	teamsApi *datadogV2.TeamsApi,
+	teamID string,
+	action datadogV2.TeamPermissionSettingSerializerAction,
+) (datadogV2.TeamPermissionSettingValue, error) {
+	settings, resp, err := teamsApi.GetTeamPermissionSettings(ctx, teamID)
+	if err != nil {
+		return "", wrapError(err, resp, fmt.Sprintf("baton-datadog: failed to get permission settings of team %s", teamID))
+	}
+
+	for _, setting := range settings.GetData() {
+		if setting.Attributes != nil && setting.Attributes.GetAction() == action {
+			return setting.Attributes.GetValue(), nil
+		}
+	}
+
+	return "", status.Errorf(codes.NotFound, "baton-datadog: team %s has no permission setting %s", teamID, action)
+}
+
+// updateTeamPermissionSetting sets the permission setting action of the team to the given value.
+func updateTeamPermissionSetting(
+	ctx context.Context,
+	teamsApi *datadogV2.TeamsApi,
+	teamID string,
+	action datadogV2.TeamPermissionSettingSerializerAction,
+	value datadogV2.TeamPermissionSettingValue,
+) error {
+	body := datadogV2.TeamPermissionSettingUpdateRequest{
+		Data: datadogV2.TeamPermissionSettingUpdate{
+			Attributes: &datadogV2.TeamPermissionSettingUpdateAttributes{
+				Value: value.Ptr(),
+			},
+			Type: datadogV2.TEAMPERMISSIONSETTINGTYPE_TEAM_PERMISSION_SETTINGS,
+		},
+	}
+
+	_, resp, err := teamsApi.UpdateTeamPermissionSetting(ctx, teamID, string(action), body)
+	if err != nil {
+		return wrapError(err, resp, fmt.Sprintf("error updating permission setting %s of team %s", action, teamID))
+	}
+
+	return nil
+}
@@ -3,8 +3,9 @@ package connector
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strings"
 
-	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
@@ -14,6 +15,8 @@ import (
 	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -22,11 +25,13 @@ const (
 )
 
 type teamBuilder struct {
-	resourceType *v2.ResourceType
-	client       *datadog.APIClient
-	apiKey       string
-	appKey       string
-	site         string
+	resourceType    *v2.ResourceType
+	client          *client
+	rolePermissions *rolePermissions
+	teamMappings    *teamMappings
+	prefetcher      *prefetcher
+	readOnly        bool
+	dryRun          bool
 }
 
 func (t *teamBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
@@ -34,13 +39,31 @@ func (t *teamBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 }
 
 // Create a new connector resource for a Datadog team.
-func teamResource(team *datadogV2.Team) (*v2.Resource, error) {
+func teamResource(team *datadogV2.Team, links []datadogV2.TeamLink) (*v2.Resource, error) {
 	profile := map[string]interface{}{
 		"team_name":        team.Attributes.GetName(),
 		"team_description": team.Attributes.GetDescription(),
 		"team_id":          team.GetId(),
+		"team_handle":      team.Attributes.GetHandle(),
+		"team_summary":     team.Attributes.GetSummary(),
+		"user_count":       int64(team.Attributes.GetUserCount()),
+		"link_count":       int64(team.Attributes.GetLinkCount()),
+		"visible_modules":  stringsToInterfaces(team.Attributes.GetVisibleModules()),
+		"hidden_modules":   stringsToInterfaces(team.Attributes.GetHiddenModules()),
 	}
 
+	var resourceOptions []rs.ResourceOption
+	var otherLinks []string
+	for _, link := range links {
+		// Only absolute https links are accepted by the ExternalLink annotation, the others are kept in the profile.
+		if !strings.HasPrefix(link.Attributes.GetUrl(), "https://") {
+			otherLinks = append(otherLinks, link.Attributes.GetUrl())
+			continue
+		}
+		resourceOptions = append(resourceOptions, rs.WithAnnotation(&v2.ExternalLink{Url: link.Attributes.GetUrl()}))
+	}
+	profile["other_links"] = stringsToInterfaces(otherLinks)
+
 	teamTraitOptions := []rs.GroupTraitOption{
 		rs.WithGroupProfile(profile),
 	}
@@ -50,6 +73,7 @@ func teamResource(team *datadogV2.Team) (*v2.Resource, error) {
 		teamResourceType,
 		team.GetId(),
 		teamTraitOptions,
+		resourceOptions...,
 	)
 	if err != nil {
 		return nil, err
@@ -60,28 +84,54 @@ func teamResource(team *datadogV2.Team) (*v2.Resource, error) {
 
 // List returns all the teams from the database as resource objects.
 func (t *teamBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
-	ctx = withAuthContext(ctx, t.apiKey, t.appKey, t.site)
-	api := datadogV2.NewTeamsApi(t.client)
+	ctx = t.client.WithAuth(ctx)
+	api := datadogV2.NewTeamsApi(t.client.api)
 
 	bag, page, err := parsePageToken(pToken.Token, &v2.ResourceId{ResourceType: t.resourceType.Id})
 	if err != nil {
 		return nil, "", nil, err
 	}
+	if pToken.Token == "" {
+		// A new sync starts, the pages prefetched for the previous one are stale.
+		t.prefetcher.Reset(teamResourceType.Id)
+	}
 
-	teams, _, err := api.ListTeams(ctx, *datadogV2.NewListTeamsOptionalParameters().WithPageNumber(page))
+	teams, resp, err := api.ListTeams(ctx, *datadogV2.NewListTeamsOptionalParameters().
+		WithPageNumber(page).
+		WithInclude([]datadogV2.ListTeamsInclude{datadogV2.LISTTEAMSINCLUDE_TEAM_LINKS}))
 	if err != nil {
-		return nil, "", nil, fmt.Errorf("error listing teams: %w", err)
+		return nil, "", nil, wrapError(err, resp, "error listing teams")
+	}
+
+	includedLinks := make(map[string]datadogV2.TeamLink)
+	for _, included := range teams.GetIncluded() {
+		if included.TeamLink != nil {
+			includedLinks[included.TeamLink.GetId()] = *included.TeamLink
+		}
 	}
 
 	var rv []*v2.Resource
+	var teamIDs []string
 	for _, team := range teams.GetData() {
 		teamCopy := team
-		tr, err := teamResource(&teamCopy)
+
+		var links []datadogV2.TeamLink
+		if teamCopy.HasRelationships() && teamCopy.Relationships.HasTeamLinks() {
+			for _, linkData := range teamCopy.Relationships.TeamLinks.GetData() {
+				if link, ok := includedLinks[linkData.GetId()]; ok {
+					links = append(links, link)
+				}
+			}
+		}
+
+		tr, err := teamResource(&teamCopy, links)
 		if err != nil {
 			return nil, "", nil, fmt.Errorf("error creating team resource: %w", err)
 		}
 		rv = append(rv, tr)
+		teamIDs = append(teamIDs, team.GetId())
 	}
+	t.prefetcher.Enqueue(teamResourceType.Id, teamIDs, t.teamMembersPage)
 
 	nextPageToken := ""
 	if len(teams.GetData()) != 0 {
@@ -94,85 +144,253 @@ func (t *teamBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId,
 	return rv, nextPageToken, nil, nil
 }
 
-func (t *teamBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+func (t *teamBuilder) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	ctx = t.client.WithAuth(ctx)
+	teamsApi := datadogV2.NewTeamsApi(t.client.api)
+
+	sources, err := t.teamMappings.ForTeam(ctx, t.client, resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
 	var rv []*v2.Entitlement
 	memberOptions := populateOptions(resource.DisplayName, memberRole)
-	memberEntitlement := ent.NewAssignmentEntitlement(resource, memberRole, memberOptions...)
-
 	adminOptions := populateOptions(resource.DisplayName, adminRole)
+	if len(sources) != 0 {
+		memberOptions = append(memberOptions, t.idpManagedOptions(resource.DisplayName, memberRole, sources)...)
+		adminOptions = append(adminOptions, t.idpManagedOptions(resource.DisplayName, adminRole, sources)...)
+	}
+
+	memberEntitlement := ent.NewAssignmentEntitlement(resource, memberRole, memberOptions...)
 	adminEntitlement := ent.NewPermissionEntitlement(resource, adminRole, adminOptions...)
 
 	rv = append(rv, memberEntitlement, adminEntitlement)
 
+	settings, resp, err := teamsApi.GetTeamPermissionSettings(ctx, resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, wrapError(err, resp, fmt.Sprintf("error getting permission settings for team %s", resource.Id.Resource))
+	}
+
+	rv = append(rv, teamPermissionEntitlements(resource, settings.GetData())...)
+
 	return rv, "", nil, nil
 }
 
+// Grants returns the permission settings of the team on the first page, then its memberships page by page.
+// The last page carries the ETag of all the memberships, fingerprinted across the pages. An ETag covers a single
+// entitlement, so admin and permission setting grants are always returned.
+//
+// When the team carries an ETag from the previous sync, the first page checks it against the memberships first,
+// without looking up their users. If they did not change the syncer keeps the member grants of the previous sync,
+// otherwise the memberships are paged again and their users looked up.
 func (t *teamBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
-	ctx = withAuthContext(ctx, t.apiKey, t.appKey, t.site)
-	teamsApi := datadogV2.NewTeamsApi(t.client)
-	usersApi := datadogV2.NewUsersApi(t.client)
-
-	bag, page, err := parsePageToken(pToken.Token, &v2.ResourceId{ResourceType: t.resourceType.Id})
+	bag, page, fp, err := parseFingerprintPageToken(pToken.Token, resource.Id)
 	if err != nil {
 		return nil, "", nil, err
 	}
 
-	memberships, _, err := teamsApi.GetTeamMemberships(ctx, resource.Id.Resource, *datadogV2.NewGetTeamMembershipsOptionalParameters().WithPageNumber(page))
+	ctx = t.client.WithAuth(ctx)
+	teamsApi := datadogV2.NewTeamsApi(t.client.api)
+	usersApi := datadogV2.NewUsersApi(t.client.api)
+
+	sources, err := t.teamMappings.ForTeam(ctx, t.client, resource.Id.Resource)
 	if err != nil {
 		return nil, "", nil, err
 	}
 
+	var membershipOptions []grant.GrantOption
+	if len(sources) != 0 {
+		mappingIDs := make([]interface{}, 0, len(sources))
+		for _, source := range sources {
+			mappingIDs = append(mappingIDs, source.MappingID)
+		}
+		membershipOptions = append(membershipOptions, grant.WithGrantMetadata(map[string]interface{}{
+			"idp_managed":    true,
+			"mapping_source": mappingSourcesString(sources),
+			"mapping_ids":    mappingIDs,
+		}))
+	}
+
 	var rv []*v2.Grant
-	for _, membership := range memberships.GetData() {
-		userId := membership.Relationships.User.GetData().Id
-		res, _, err := usersApi.GetUser(ctx, userId)
+	if page == 0 {
+		// The mappings are part of the fingerprint since they end up in the metadata of the member grants.
+		for _, source := range sources {
+			fp.Add("mapping:" + source.MappingID + ":" + source.String())
+		}
+
+		settings, resp, err := teamsApi.GetTeamPermissionSettings(ctx, resource.Id.Resource)
+		if err != nil {
+			return nil, "", nil, wrapError(err, resp, fmt.Sprintf("error getting permission settings for team %s", resource.Id.Resource))
+		}
+		rv, err = t.permissionSettingGrants(ctx, resource, settings.GetData())
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("error resolving permission settings for team %s: %w", resource.Id.Resource, err)
+		}
+
+		if hasETag(resource, memberRole) {
+			adminGrants, annos, matched, err := t.matchMemberships(ctx, resource, fp, membershipOptions)
+			if err != nil {
+				return nil, "", nil, err
+			}
+			if matched {
+				return append(rv, adminGrants...), "", annos, nil
+			}
+		}
+	}
+
+	value, err := t.prefetcher.Take(ctx, teamResourceType.Id, resource.Id.Resource, page, t.teamMembersPage)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	members, _ := value.([]teamMember)
+	if len(members) == 0 {
+		annos, _ := etagAnnotations(resource, memberRole, fp.String())
+		return rv, "", annos, nil
+	}
+
+	for _, member := range members {
+		res, resp, err := usersApi.GetUser(ctx, member.userID)
 		if err != nil {
-			return nil, "", nil, fmt.Errorf("error getting user %s from team membership: %w", userId, err)
+			return nil, "", nil, wrapError(err, resp, fmt.Sprintf("error getting user %s from team membership", member.userID))
 		}
 		user := res.GetData()
 		ur, err := userResource(&user)
 		if err != nil {
 			return nil, "", nil, fmt.Errorf("error creating user resource for team %s: %w", resource.Id.Resource, err)
 		}
-		gr := grant.NewGrant(resource, memberRole, ur.Id)
-		rv = append(rv, gr)
 
-		if membership.HasAttributes() {
-			if membership.Attributes.GetRole() == adminRole {
-				gr = grant.NewGrant(resource, adminRole, ur.Id)
-				rv = append(rv, gr)
-			}
+		rv = append(rv, grant.NewGrant(resource, memberRole, ur.Id, membershipOptions...))
+		if member.admin {
+			rv = append(rv, grant.NewGrant(resource, adminRole, ur.Id, membershipOptions...))
 		}
+		fp.Add("user:" + member.userID)
 	}
 
-	nextPageToken := ""
-	if len(memberships.GetData()) != 0 {
-		nextPageToken, err = getPageTokenFromPage(bag, page+1)
+	nextPageToken, err := getFingerprintPageToken(bag, page+1, fp)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("datadog-connector: failed to get token from page: %w", err)
+	}
+
+	return rv, nextPageToken, nil, nil
+}
+
+// matchMemberships fingerprints the memberships of the team on top of fp and checks it against the ETag of the
+// previous sync. On a match it returns the admin grants, which the ETag does not cover. Only the membership pages
+// are fetched, their users are not looked up.
+func (t *teamBuilder) matchMemberships(
+	ctx context.Context,
+	resource *v2.Resource,
+	fp fingerprint,
+	membershipOptions []grant.GrantOption,
+) ([]*v2.Grant, annotations.Annotations, bool, error) {
+	var adminGrants []*v2.Grant
+	for page := int64(0); ; page++ {
+		value, err := t.prefetcher.Take(ctx, teamResourceType.Id, resource.Id.Resource, page, t.teamMembersPage)
 		if err != nil {
-			return nil, "", nil, fmt.Errorf("datadog-connector: failed to get token from page: %w", err)
+			return nil, nil, false, err
+		}
+		members, _ := value.([]teamMember)
+		if len(members) == 0 {
+			break
+		}
+
+		for _, member := range members {
+			fp.Add("user:" + member.userID)
+			if member.admin {
+				adminGrants = append(adminGrants, grant.NewGrant(resource, adminRole, userResourceID(member.userID), membershipOptions...))
+			}
 		}
 	}
 
-	return rv, nextPageToken, nil, nil
+	annos, matched := etagAnnotations(resource, memberRole, fp.String())
+	if !matched {
+		return nil, nil, false, nil
+	}
+
+	return adminGrants, annos, true, nil
+}
+
+// teamMember is a user holding a membership of a team.
+type teamMember struct {
+	userID string
+	admin  bool
+}
+
+// teamMembersPage fetches a page of the memberships of a team, it is a pageFetcher for the prefetcher.
+func (t *teamBuilder) teamMembersPage(ctx context.Context, teamID string, page int64) (interface{}, bool, error) {
+	ctx = t.client.WithAuth(ctx)
+	teamsApi := datadogV2.NewTeamsApi(t.client.api)
+
+	memberships, resp, err := teamsApi.GetTeamMemberships(ctx, teamID, *datadogV2.NewGetTeamMembershipsOptionalParameters().WithPageNumber(page))
+	if err != nil {
+		return nil, false, wrapError(err, resp, fmt.Sprintf("error listing memberships of team %s", teamID))
+	}
+
+	members := make([]teamMember, 0, len(memberships.GetData()))
+	for _, membership := range memberships.GetData() {
+		members = append(members, teamMember{
+			userID: membership.Relationships.User.GetData().Id,
+			admin:  membership.HasAttributes() && membership.Attributes.GetRole() == adminRole,
+		})
+	}
+
+	return members, len(members) != 0, nil
 }
 
 func (t *teamBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
 	l := ctxzap.Extract(ctx)
 
+	if err := checkWritable(t.readOnly, "grant team entitlement"); err != nil {
+		return nil, err
+	}
+
+	if action, value, ok := parseTeamPermissionSlug(entitlement.Slug); ok {
+		return t.grantPermissionSetting(ctx, principal, entitlement, action, value)
+	}
+
 	if principal.Id.ResourceType != userResourceType.Id {
 		l.Warn(
 			"baton-datadog: only users can be granted team membership",
 			zap.String("principal_type", principal.Id.ResourceType),
 			zap.String("principal_id", principal.Id.Resource),
 		)
-		return nil, fmt.Errorf("baton-datadog: only users can be granted team membership")
+		return nil, status.Error(codes.InvalidArgument, "baton-datadog: only users can be granted team membership")
+	}
+
+	ctx = t.client.WithAuth(ctx)
+	err := t.checkNotIdPManaged(ctx, entitlement.Resource.Id.Resource)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.dryRun {
+		return t.planTeamMembership(ctx, principal.Id.Resource, entitlement.Resource.Id.Resource, entitlement.Slug, true)
+	}
+
+	teamID := entitlement.Resource.Id.Resource
+	teamsApi := datadogV2.NewTeamsApi(t.client.api)
+	membership, err := findTeamMembership(ctx, teamsApi, teamID, principal.Id.Resource)
+	if err != nil {
+		return nil, err
 	}
 
 	var role *datadogV2.UserTeamRole
-	if entitlement.Slug == "admin" {
+	if entitlement.Slug == adminRole {
 		role = datadogV2.USERTEAMROLE_ADMIN.Ptr()
 	}
 
+	switch {
+	case membership != nil && (role == nil || isTeamAdmin(membership)):
+		return noOpAnnotations(fmt.Sprintf("user already holds %s of the team", entitlement.Slug))
+	case membership != nil:
+		// Members are promoted in place, creating the membership again would conflict.
+		err = updateTeamMembershipRole(ctx, teamsApi, teamID, principal.Id.Resource, role)
+		if err != nil {
+			return nil, fmt.Errorf("baton-datadog: failed to make user team admin: %w", err)
+		}
+		return nil, nil
+	}
+
 	body := datadogV2.UserTeamRequest{
 		Data: datadogV2.UserTeamCreate{
 			Attributes: &datadogV2.UserTeamAttributes{
@@ -190,11 +408,12 @@ func (t *teamBuilder) Grant(ctx context.Context, principal *v2.Resource, entitle
 		},
 	}
 
-	ctx = withAuthContext(ctx, t.apiKey, t.appKey, t.site)
-	teamsApi := datadogV2.NewTeamsApi(t.client)
-	_, _, err := teamsApi.CreateTeamMembership(ctx, entitlement.Resource.Id.Resource, body)
+	_, resp, err := teamsApi.CreateTeamMembership(ctx, teamID, body)
 	if err != nil {
-		return nil, fmt.Errorf("baton-datadog: failed to add user to role: %w", err)
+		if hasStatus(resp, http.StatusConflict) {
+			return noOpAnnotations("user is already a member of the team")
+		}
+		return nil, wrapError(err, resp, "baton-datadog: failed to add user to team")
 	}
 
 	return nil, nil
@@ -205,26 +424,170 @@ func (t *teamBuilder) Revoke(ctx context.Context, grant *v2.Grant) (annotations.
 	principal := grant.Principal
 	entitlement := grant.Entitlement
 
+	if err := checkWritable(t.readOnly, "revoke team entitlement"); err != nil {
+		return nil, err
+	}
+
+	if action, value, ok := parseTeamPermissionSlug(entitlement.Slug); ok {
+		return t.revokePermissionSetting(ctx, principal, entitlement, action, value)
+	}
+
 	if principal.Id.ResourceType != userResourceType.Id {
 		l.Warn(
 			"baton-datadog: only users can have team membership revoked",
 			zap.String("principal_type", principal.Id.ResourceType),
 			zap.String("principal_id", principal.Id.Resource),
 		)
-		return nil, fmt.Errorf("baton-datadog: only users can have team membership revoked")
+		return nil, status.Error(codes.InvalidArgument, "baton-datadog: only users can have team membership revoked")
 	}
 
-	ctx = withAuthContext(ctx, t.apiKey, t.appKey, t.site)
-	teamsApi := datadogV2.NewTeamsApi(t.client)
+	ctx = t.client.WithAuth(ctx)
+	err := t.checkNotIdPManaged(ctx, entitlement.Resource.Id.Resource)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.dryRun {
+		return t.planTeamMembership(ctx, principal.Id.Resource, entitlement.Resource.Id.Resource, entitlement.Slug, false)
+	}
+
+	teamID := entitlement.Resource.Id.Resource
+	teamsApi := datadogV2.NewTeamsApi(t.client.api)
+	membership, err := findTeamMembership(ctx, teamsApi, teamID, principal.Id.Resource)
+	if err != nil {
+		return nil, err
+	}
+
+	if entitlement.Slug == adminRole {
+		if !isTeamAdmin(membership) {
+			return noOpAnnotations("user is not an admin of the team")
+		}
 
-	_, err := teamsApi.DeleteTeamMembership(ctx, entitlement.Resource.Id.Resource, principal.Id.Resource)
+		// Revoking admin demotes the user to a regular member instead of removing them from the team.
+		err = updateTeamMembershipRole(ctx, teamsApi, teamID, principal.Id.Resource, nil)
+		if err != nil {
+			return nil, fmt.Errorf("baton-datadog: failed to remove team admin role from user: %w", err)
+		}
+		return nil, nil
+	}
+
+	if membership == nil {
+		return noOpAnnotations("user is not a member of the team")
+	}
+
+	resp, err := teamsApi.DeleteTeamMembership(ctx, teamID, principal.Id.Resource)
 	if err != nil {
-		return nil, fmt.Errorf("baton-datadog: failed to remove user from team: %w", err)
+		if hasStatus(resp, http.StatusNotFound) {
+			return noOpAnnotations("user is not a member of the team")
+		}
+		return nil, wrapError(err, resp, "baton-datadog: failed to remove user from team")
 	}
 
 	return nil, nil
 }
 
+// grantPermissionSetting sets the team permission setting to the value of the entitlement.
+func (t *teamBuilder) grantPermissionSetting(
+	ctx context.Context,
+	principal *v2.Resource,
+	entitlement *v2.Entitlement,
+	action datadogV2.TeamPermissionSettingSerializerAction,
+	value datadogV2.TeamPermissionSettingValue,
+) (annotations.Annotations, error) {
+	if !isPermissionSettingPrincipal(principal, entitlement) {
+		return nil, status.Error(codes.InvalidArgument, "baton-datadog: team permission settings can only be granted to their team")
+	}
+
+	ctx = t.client.WithAuth(ctx)
+	if t.dryRun {
+		return t.planPermissionSetting(ctx, entitlement.Resource.Id.Resource, action, value, true)
+	}
+
+	teamsApi := datadogV2.NewTeamsApi(t.client.api)
+	current, err := getTeamPermissionSetting(ctx, teamsApi, entitlement.Resource.Id.Resource, action)
+	if err != nil {
+		return nil, err
+	}
+	if current == value {
+		return noOpAnnotations(fmt.Sprintf("team permission setting %s is already set to %s", action, value))
+	}
+
+	err = updateTeamPermissionSetting(ctx, teamsApi, entitlement.Resource.Id.Resource, action, value)
+	if err != nil {
+		return nil, fmt.Errorf("baton-datadog: failed to update team permission setting %s: %w", action, err)
+	}
+
+	return nil, nil
+}
+
+// revokePermissionSetting resets the team permission setting back to the Datadog default.
+func (t *teamBuilder) revokePermissionSetting(
+	ctx context.Context,
+	principal *v2.Resource,
+	entitlement *v2.Entitlement,
+	action datadogV2.TeamPermissionSettingSerializerAction,
+	value datadogV2.TeamPermissionSettingValue,
+) (annotations.Annotations, error) {
+	if !isPermissionSettingPrincipal(principal, entitlement) {
+		return nil, status.Error(codes.InvalidArgument, "baton-datadog: team permission settings can only be revoked from their team")
+	}
+
+	if value == defaultTeamPermissionValue {
+		return nil, status.Errorf(codes.FailedPrecondition, "baton-datadog: team permission setting %s cannot be revoked from its default value %s", action, value)
+	}
+
+	ctx = t.client.WithAuth(ctx)
+	if t.dryRun {
+		return t.planPermissionSetting(ctx, entitlement.Resource.Id.Resource, action, value, false)
+	}
+
+	teamsApi := datadogV2.NewTeamsApi(t.client.api)
+	current, err := getTeamPermissionSetting(ctx, teamsApi, entitlement.Resource.Id.Resource, action)
+	if err != nil {
+		return nil, err
+	}
+	if current != value {
+		return noOpAnnotations(fmt.Sprintf("team permission setting %s is not set to %s", action, value))
+	}
+
+	err = updateTeamPermissionSetting(ctx, teamsApi, entitlement.Resource.Id.Resource, action, defaultTeamPermissionValue)
+	if err != nil {
+		return nil, fmt.Errorf("baton-datadog: failed to reset team permission setting %s: %w", action, err)
+	}
+
+	return nil, nil
+}
+
+// idpManagedOptions marks a team membership entitlement as managed by SAML mappings,
+// linking to the mappings page in Datadog where the membership has to be changed instead.
+func (t *teamBuilder) idpManagedOptions(name, permission string, sources []teamMappingSource) []ent.EntitlementOption {
+	return []ent.EntitlementOption{
+		ent.WithDescription(fmt.Sprintf("%s of %s Datadog team, managed by SAML mapping %s", permission, name, mappingSourcesString(sources))),
+		ent.WithAnnotation(&v2.ExternalLink{Url: t.client.AppURL() + "/organization-settings/mappings"}),
+	}
+}
+
+// checkNotIdPManaged returns an error if the membership of the team is managed by SAML mappings,
+// since Datadog would overwrite any change made by Baton on the next login of the user.
+func (t *teamBuilder) checkNotIdPManaged(ctx context.Context, teamID string) error {
+	sources, err := t.teamMappings.ForTeam(ctx, t.client, teamID)
+	if err != nil {
+		return err
+	}
+
+	if len(sources) != 0 {
+		return status.Errorf(
+			codes.FailedPrecondition,
+			"baton-datadog: membership of team %s is managed by SAML mapping %s, change it in your identity provider or at %s",
+			teamID,
+			mappingSourcesString(sources),
+			t.client.AppURL()+"/organization-settings/mappings",
+		)
+	}
+
+	return nil
+}
+
 func populateOptions(name, permission string) []ent.EntitlementOption {
 	options := []ent.EntitlementOption{
 		ent.WithGrantableTo(userResourceType),
@@ -234,12 +597,20 @@ func populateOptions(name, permission string) []ent.EntitlementOption {
 	return options
 }
 
-func newTeamBuilder(client *datadog.APIClient, site, apiKey, appKey string) *teamBuilder {
+func newTeamBuilder(
+	client *client,
+	rolePermissions *rolePermissions,
+	teamMappings *teamMappings,
+	prefetcher *prefetcher,
+	readOnly, dryRun bool,
+) *teamBuilder {
 	return &teamBuilder{
-		resourceType: teamResourceType,
-		client:       client,
-		site:         site,
-		apiKey:       apiKey,
-		appKey:       appKey,
+		resourceType:    teamResourceType,
+		client:          client,
+		rolePermissions: rolePermissions,
+		teamMappings:    teamMappings,
+		prefetcher:      prefetcher,
+		readOnly:        readOnly,
+		dryRun:          dryRun,
 	}
 }
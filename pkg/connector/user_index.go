@@ -0,0 +1,82 @@
+package connector
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+// userIndex is a lazily loaded index of user IDs by handle and email. Datadog identifies the creators and owners
+// of many resources by handle or email only, the index resolves them to the synced users.
+// It is shared between builders so the users are only listed once per sync.
+type userIndex struct {
+	mu       sync.Mutex
+	loadedAt time.Time
+	byHandle map[string]string
+}
+
+func newUserIndex() *userIndex {
+	return &userIndex{}
+}
+
+// UserID returns the ID of the user with the given handle or email, compared case-insensitively.
+func (u *userIndex) UserID(ctx context.Context, client *client, handle string) (string, bool, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	err := u.load(ctx, client)
+	if err != nil {
+		return "", false, err
+	}
+
+	id, ok := u.byHandle[strings.ToLower(handle)]
+	return id, ok, nil
+}
+
+func (u *userIndex) load(ctx context.Context, client *client) error {
+	if !u.loadedAt.IsZero() && time.Since(u.loadedAt) < indexTTL {
+		return nil
+	}
+
+	usersApi := datadogV2.NewUsersApi(client.api)
+
+	byHandle := make(map[string]string)
+	for page := int64(0); ; page++ {
+		users, resp, err := usersApi.ListUsers(ctx, *datadogV2.NewListUsersOptionalParameters().WithPageNumber(page))
+		if err != nil {
+			return wrapError(err, resp, "error listing users")
+		}
+
+		if len(users.GetData()) == 0 {
+			break
+		}
+
+		for _, user := range users.GetData() {
+			if user.Attributes == nil {
+				continue
+			}
+			for _, handle := range []string{user.Attributes.GetHandle(), user.Attributes.GetEmail()} {
+				if handle != "" {
+					byHandle[strings.ToLower(handle)] = user.GetId()
+				}
+			}
+		}
+	}
+
+	u.byHandle = byHandle
+	u.loadedAt = time.Now()
+
+	return nil
+}
+
+// userResourceID returns the resource ID of the user with the given ID.
+func userResourceID(userID string) *v2.ResourceId {
+	return &v2.ResourceId{
+		ResourceType: userResourceType.Id,
+		Resource:     userID,
+	}
+}